@@ -0,0 +1,207 @@
+package gosh
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/polydawn/gosh/iox"
+)
+
+/*
+	Limits how much of a command's output is kept in memory by the helpers
+	that capture it (`Output()`, `CombinedOutput()`, `RunAndReport()`).
+
+	Only the first `Head` bytes and the last `Tail` bytes are kept; anything
+	in between is replaced by a marker like "...1234 bytes elided...".
+	Either may be `CaptureUnlimited`, in which case nothing is ever elided,
+	so all the output is kept (see `CaptureAll`).  Other negative sizes
+	are rejected with a `CaptureLimitError` when the command is run.
+
+	The zero value, `CaptureDefault`, means "the helper's default":
+	`Output()` and `CombinedOutput()` keep everything, and `RunAndReport()`
+	keeps `DefaultReportCapture`.  Since that leaves zero for both sizes
+	meaning something else, use `CaptureNothing` to keep nothing at all.
+*/
+type CaptureLimit struct {
+	Head int
+	Tail int
+
+	set bool // distinguishes `CaptureNothing` from `CaptureDefault`
+}
+
+/* A `CaptureLimit` size meaning no limit at all. */
+const CaptureUnlimited = -1
+
+var (
+	/* Use the capturing helper's own default.  This is the zero value. */
+	CaptureDefault = CaptureLimit{}
+
+	/* Keep all output, however large. */
+	CaptureAll = CaptureLimit{Head: CaptureUnlimited, Tail: CaptureUnlimited}
+
+	/* Keep no output at all (though how much there was is still counted). */
+	CaptureNothing = CaptureLimit{set: true}
+
+	/*
+		How much output `RunAndReport()` keeps for the error message if
+		not told otherwise: plenty for the usual reasons a command failed,
+		and still a sane size when a compiler spews megabytes of errors.
+	*/
+	DefaultReportCapture = CaptureLimit{Head: 32 * 1024, Tail: 32 * 1024}
+)
+
+type captureBuffer interface {
+	io.Writer
+	String() string
+}
+
+/*
+	Returns the limit to actually use: `dflt` if this is `CaptureDefault`.
+	Panics with a `CaptureLimitError` if the sizes don't make sense.
+*/
+func (cl CaptureLimit) resolve(dflt CaptureLimit) CaptureLimit {
+	if cl == CaptureDefault {
+		cl = dflt
+	}
+	if cl.Head < CaptureUnlimited || cl.Tail < CaptureUnlimited {
+		panic(CaptureLimitError{Limit: cl})
+	}
+	return cl
+}
+
+func (cl CaptureLimit) unlimited() bool {
+	return cl.Head == CaptureUnlimited || cl.Tail == CaptureUnlimited
+}
+
+func (cl CaptureLimit) buffer(dflt CaptureLimit) captureBuffer {
+	cl = cl.resolve(dflt)
+	if cl.unlimited() {
+		return &bytes.Buffer{}
+	}
+	return iox.NewHeadTailBuffer(cl.Head, cl.Tail)
+}
+
+/*
+	Records a transcript of a process's output streams, keeping only the
+	first and last part (by bytes) according to a `CaptureLimit`.
+*/
+type transcriptRecorder struct {
+	mutex      sync.Mutex
+	limit      CaptureLimit
+	head       Transcript
+	headBytes  int
+	tail       Transcript
+	tailBytes  int
+	elided     int64
+	lastStream Stream
+}
+
+func newTranscriptRecorder(limit CaptureLimit) *transcriptRecorder {
+	return &transcriptRecorder{limit: limit}
+}
+
+/*
+	Returns a writer that records everything written to it as being on `stream`.
+*/
+func (r *transcriptRecorder) stream(stream Stream) io.Writer {
+	return transcriptStreamWriter{r, stream}
+}
+
+type transcriptStreamWriter struct {
+	r      *transcriptRecorder
+	stream Stream
+}
+
+func (w transcriptStreamWriter) Write(p []byte) (int, error) {
+	w.r.record(w.stream, string(p))
+	return len(p), nil
+}
+
+func (r *transcriptRecorder) record(stream Stream, data string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.lastStream = stream
+	if r.limit.unlimited() {
+		r.head = append(r.head, TranscriptEntry{Time: now, Stream: stream, Data: data})
+		return
+	}
+	if room := r.limit.Head - r.headBytes; room > 0 {
+		if room > len(data) {
+			room = len(data)
+		}
+		r.head = append(r.head, TranscriptEntry{Time: now, Stream: stream, Data: data[:room]})
+		r.headBytes += room
+		data = data[room:]
+	}
+	if len(data) == 0 {
+		return
+	}
+	r.tail = append(r.tail, TranscriptEntry{Time: now, Stream: stream, Data: data})
+	r.tailBytes += len(data)
+	for r.tailBytes > r.limit.Tail {
+		excess := r.tailBytes - r.limit.Tail
+		if oldest := r.tail[0].Data; len(oldest) <= excess {
+			r.tail = r.tail[1:]
+			r.tailBytes -= len(oldest)
+			r.elided += int64(len(oldest))
+		} else {
+			r.tail[0].Data = oldest[excess:]
+			r.tailBytes -= excess
+			r.elided += int64(excess)
+		}
+	}
+}
+
+func (r *transcriptRecorder) transcript() Transcript {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	t := append(Transcript(nil), r.head...)
+	tail := append(Transcript(nil), r.tail...)
+	if r.elided > 0 {
+		if len(tail) == 0 {
+			// nothing after the gap to hang the note on; leave an empty entry for it.
+			tail = Transcript{{Time: time.Now(), Stream: r.lastStream}}
+		}
+		tail[0].Elided = r.elided
+	}
+	return append(t, tail...)
+}
+
+/*
+	Sends output to `capture`, and also to `live` if there is one.
+*/
+func teeIfLive(live interface{}, capture io.Writer) interface{} {
+	if live == nil {
+		return capture
+	}
+	return iox.Tee(live, capture)
+}
+
+/*
+	Serializes writes to a writer that's shared between goroutines.
+	Passes through `Flush`, if the writer has it.
+*/
+type lockedWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+	return lw.w.Write(p)
+}
+
+func (lw *lockedWriter) Flush() error {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+	if f, ok := lw.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package gosh
+
+import (
+	"hash/fnv"
+	"io"
+	"time"
+
+	"github.com/polydawn/gosh/iox"
+)
+
+/*
+	Decoration configures gosh to mark up each line of a command's output
+	(both stdout and stderr) as it's written, which is handy when several
+	commands run at once are all writing to e.g. `os.Stdout`.
+
+	For example, `Opts{Out: os.Stdout, Decorate: Decoration{Label: true}}`
+	on a command "make" produces lines like:
+
+		make| cc -c foo.c
+
+	Whole lines are written at a time, so commands sharing a destination
+	don't garble each other's lines.
+*/
+type Decoration struct {
+	/* Prefix each line with a label, followed by "| ". */
+	Label bool
+
+	/* The label to use; if empty, the command name. */
+	LabelText string
+
+	/* Color the label (with ANSI escape codes), picking a color by the label's text. */
+	Color bool
+
+	/* If set, prefix each line (before any label) with the time, in this layout (as for `time.Time.Format`). */
+	Timestamp string
+}
+
+func (d Decoration) enabled() bool {
+	return d.Label || d.Timestamp != ""
+}
+
+var labelColors = []string{"31", "32", "33", "34", "35", "36"}
+
+/*
+	Wraps `w` according to the decoration.  The returned writer needs
+	closing (which doesn't close `w`) when the command is done with it.
+*/
+func (d Decoration) wrap(w io.Writer, cmdname string) *iox.LineDecorator {
+	var prefix string
+	if d.Label {
+		label := d.LabelText
+		if label == "" {
+			label = cmdname
+		}
+		if d.Color {
+			h := fnv.New32a()
+			h.Write([]byte(label))
+			label = "\x1b[" + labelColors[h.Sum32()%uint32(len(labelColors))] + "m" + label + "\x1b[0m"
+		}
+		prefix = label + "| "
+	}
+	if d.Timestamp == "" {
+		return iox.PrefixLines(w, prefix)
+	}
+	return iox.DecorateLines(w, func() string {
+		return time.Now().Format(d.Timestamp) + " " + prefix
+	})
+}
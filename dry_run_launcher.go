@@ -0,0 +1,83 @@
+package gosh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/polydawn/gosh/iox"
+)
+
+/*
+	The environment variable that switches `Gosh()` to the `DryRunLauncher`.
+	Any value `strconv.ParseBool` takes as true will do (e.g. "1" or "true").
+*/
+const DryRunEnv = "GOSH_DRYRUN"
+
+var _ Launcher = DryRunLauncher
+
+/*
+	Doesn't run anything: prints the command to stderr, as a line of shell
+	that would run it (env changes, cwd, args, and redirections, all
+	quoted so it can be pasted as-is), and returns a Proc that has
+	already exited successfully.
+
+	Nothing is read from the command's input or written to its output, so
+	e.g. `Output()` returns an empty string.  No files are opened for
+	redirects.  Commands piped into this one aren't launched either;
+	they're printed as part of the pipeline.
+
+	`Gosh()` uses this instead of `ExecLauncher` when the `GOSH_DRYRUN`
+	environment variable is set (see `DryRunEnv`), so a whole script can
+	be previewed safely.
+*/
+func DryRunLauncher(cmdt Opts) Proc {
+	return dryRun(cmdt, os.Stderr)
+}
+
+/*
+	Returns a Launcher like `DryRunLauncher`, but printing to `w`.
+*/
+func DryRunTo(w io.Writer) Launcher {
+	return func(cmdt Opts) Proc {
+		return dryRun(cmdt, w)
+	}
+}
+
+func dryRun(cmdt Opts, w io.Writer) Proc {
+	if cmdt.Args == nil || len(cmdt.Args) < 1 {
+		panic(NoArgumentsError{})
+	}
+	fmt.Fprintln(w, cmdt.String())
+
+	// whoever's reading from channels we were to close would otherwise wait forever
+	if cmdt.CloseOut && iox.IsChanSink(cmdt.Out) {
+		iox.WriterFromInterface(cmdt.Out).(io.Closer).Close()
+	}
+	if cmdt.CloseErr && iox.IsChanSink(cmdt.Err) && !(cmdt.CloseOut && sameSink(cmdt.Err, cmdt.Out)) {
+		iox.WriterFromInterface(cmdt.Err).(io.Closer).Close()
+	}
+
+	p := newSyntheticProc(ExitStatus{Exited: true})
+	p.finish()
+	return p
+}
+
+/*
+	The launcher `Gosh()` starts commands with: `ExecLauncher`, unless
+	dry runs have been switched on with `DryRunEnv`.
+*/
+func defaultLauncher() Launcher {
+	return launcherForDryRun(os.Getenv(DryRunEnv))
+}
+
+/*
+	Picks the default launcher given the value of `DryRunEnv`.
+*/
+func launcherForDryRun(setting string) Launcher {
+	if on, _ := strconv.ParseBool(setting); on {
+		return DryRunLauncher
+	}
+	return ExecLauncher
+}
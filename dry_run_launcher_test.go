@@ -0,0 +1,73 @@
+package gosh
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDryRun(t *testing.T) {
+	Convey("Given a dry run launcher", t, func() {
+		var buf bytes.Buffer
+		cmd := Gosh(Opts{Launcher: DryRunTo(&buf)})
+
+		Convey("Plain commands should print as they'd be typed", func() {
+			p := cmd.Bake("echo", "hello world", "it's", "$HOME").Run()
+			So(buf.String(), ShouldEqual, `echo 'hello world' 'it'\''s' '$HOME'`+"\n")
+			So(p.State(), ShouldEqual, FINISHED)
+			So(p.GetExitCode(), ShouldEqual, 0)
+		})
+
+		Convey("Env changes, cwd, and redirections should be rendered", func() {
+			cmd.Bake("make", "all", Env{"CC": "clang", "HOME": ""}, Opts{
+				Cwd: "/src/my proj",
+				Out: Append("build.log"),
+				Err: Append("build.log"),
+			}).Run()
+			So(buf.String(), ShouldEqual, `cd '/src/my proj' && env -u HOME CC=clang make all >>build.log 2>&1`+"\n")
+		})
+
+		Convey("Discarded and captured output should be rendered as such", func() {
+			out := enclose(Opts{
+				Launcher: DryRunTo(&buf),
+				Args:     []string{"ls"},
+				Env:      getOsEnv(),
+				In:       FromFile("list"),
+				OkExit:   []int{0},
+			}).Output()
+			So(out, ShouldEqual, "")
+			So(buf.String(), ShouldEqual, "ls <list 2>/dev/null\n")
+		})
+
+		Convey("Pipelines should be rendered without launching anything", func() {
+			Pipe(
+				cmd.Bake("cat", Opts{In: "a\nb\n"}),
+				cmd.Bake("sort", Opts{Cwd: "/tmp"}),
+			).Run()
+			So(buf.String(), ShouldEqual, `printf %s 'a`+"\n"+`b`+"\n"+`' | cat | (cd /tmp && sort)`+"\n")
+		})
+
+		Convey("Files shouldn't be touched", func() {
+			dir, _ := os.Getwd()
+			path := filepath.Join(dir, "dry-run-should-not-exist")
+			cmd.Bake("echo", Opts{Out: File(path)}).Run()
+			_, err := os.Stat(path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+
+	Convey("Setting GOSH_DRYRUN should switch Gosh() to dry runs", t, func() {
+		isDryRun := func(l Launcher) bool {
+			return reflect.ValueOf(l).Pointer() == reflect.ValueOf(DryRunLauncher).Pointer()
+		}
+		So(isDryRun(launcherForDryRun("1")), ShouldBeTrue)
+		So(isDryRun(launcherForDryRun("true")), ShouldBeTrue)
+		So(isDryRun(launcherForDryRun("")), ShouldBeFalse)
+		So(isDryRun(launcherForDryRun("0")), ShouldBeFalse)
+		So(isDryRun(launcherForDryRun("yes please")), ShouldBeFalse)
+	})
+}
@@ -3,7 +3,9 @@ package gosh
 import (
 	"fmt"
 	"reflect"
+	"runtime"
 	"strings"
+	"time"
 )
 
 /*
@@ -14,15 +16,27 @@ import (
 	Configuration errors:
 	  - IncomprehensibleCommandModifierError
 	  - NoArgumentsError
+	  - CaptureLimitError
 
 	Execution errors:
 	  - NoSuchCommandError
 	  - ProcMonitorError
+	  - CancelledError
+	  - TimeoutError
+	  - ExpectTimeoutError
+	  - ExpectEOFError
+	  - OutputDecodeError
+	  - RedirectError
+	  - ExtraFDError
+	  - NoRecordingError
+	  - RecordingFileError
 	  - FailureExitCode
 
 	Gosh typically raises errors with panics.  This is a deliberate design
 	choice to make the easiest, tersest usages of gosh feel as much as possible
 	like writing a shell script with "-e" mode (exit immediately on error) set.
+	For applications where that's unwelcome, the "E" variants of the methods
+	on `Command` (e.g. `RunE()`) return the very same errors instead.
 
 	All gosh errors can be distingushed by use of type switches.
 	(Gosh does not use "value" type errors (i.e. `var SomeError = fmt.Errorf[...]`)
@@ -50,10 +64,39 @@ var _ []Error = []Error{
 	NoArgumentsError{},
 	NoSuchCwdError{},
 	ProcMonitorError{},
+	CancelledError{},
+	TimeoutError{},
+	ExpectTimeoutError{},
+	ExpectEOFError{},
+	OutputDecodeError{},
+	RedirectError{},
+	ExtraFDError{},
+	NoRecordingError{},
+	RecordingFileError{},
 	IncomprehensibleCommandModifierError{},
+	CaptureLimitError{},
 	FailureExitCode{},
 }
 
+/*
+	Recovers a panic into `*err`, for use in a defer by the functions that
+	return errors instead of panicking.
+
+	Only errors are recovered, and runtime errors are not (those are bugs,
+	not failures); anything else keeps on panicking.
+*/
+func recoverError(err *error) {
+	switch rec := recover().(type) {
+	case nil:
+	case runtime.Error:
+		panic(rec)
+	case error:
+		*err = rec
+	default:
+		panic(rec)
+	}
+}
+
 /*
 	NoSuchCommandError is raised when a command name (the first argument)
 	cannot be found.
@@ -111,6 +154,147 @@ func (err ProcMonitorError) Error() string {
 }
 func (err ProcMonitorError) GoshError() {}
 
+/*
+	CancelledError is raised when a command was stopped because the
+	`context.Context` it was launched with (see `Opts.Context`) was cancelled.
+
+	The Proc `State()` will be `CANCELLED`.  If the context was already
+	done before the command could be launched, it is never started.
+*/
+type CancelledError struct {
+	Cmdname string
+	Cause   error // the `Err()` of the context; e.g. `context.Canceled` or `context.DeadlineExceeded`
+}
+
+func (err CancelledError) Error() string {
+	return fmt.Sprintf("gosh: command \"%s\" cancelled: %s", err.Cmdname, err.Cause)
+}
+func (err CancelledError) GoshError() {}
+
+/*
+	TimeoutError is raised when a command was stopped because it was still
+	running when its `Opts.Timeout` elapsed.
+
+	The Proc `State()` will be `CANCELLED`.  This is distinct from
+	`FailureExitCode`: it means the command hung, not that it failed.
+*/
+type TimeoutError struct {
+	Cmdname string
+	Timeout time.Duration
+}
+
+func (err TimeoutError) Error() string {
+	return fmt.Sprintf("gosh: command \"%s\" timed out after %s", err.Cmdname, err.Timeout)
+}
+func (err TimeoutError) GoshError() {}
+
+/*
+	ExpectTimeoutError is raised by an `Expecter` when the output it was
+	waiting for didn't show up in time.
+*/
+type ExpectTimeoutError struct {
+	Pattern   string // the pattern that was expected; empty if waiting for the output to end
+	Timeout   time.Duration
+	Unmatched string // the output received that hadn't been consumed by any match
+}
+
+func (err ExpectTimeoutError) Error() string {
+	what := "end of output"
+	if err.Pattern != "" {
+		what = fmt.Sprintf("output matching %q", err.Pattern)
+	}
+	return fmt.Sprintf("gosh: expect: timed out after %s waiting for %s; unmatched output was %q", err.Timeout, what, err.Unmatched)
+}
+func (err ExpectTimeoutError) GoshError() {}
+
+/*
+	ExpectEOFError is raised by an `Expecter` when the output ended before
+	anything matching the expected pattern showed up.
+*/
+type ExpectEOFError struct {
+	Pattern   string // the pattern that was expected
+	Unmatched string // the output received that hadn't been consumed by any match
+}
+
+func (err ExpectEOFError) Error() string {
+	return fmt.Sprintf("gosh: expect: output ended while waiting for output matching %q; unmatched output was %q", err.Pattern, err.Unmatched)
+}
+func (err ExpectEOFError) GoshError() {}
+
+/*
+	OutputDecodeError is raised by the decoding output helpers like
+	`Command.OutputJSON` when the command's output couldn't be parsed.
+*/
+type OutputDecodeError struct {
+	Cmdname string
+	Format  string // what we were trying to parse the output as; e.g. "JSON"
+	Cause   error  // the error from the decoder
+	Snippet string // some of the output, from around where decoding failed
+}
+
+func (err OutputDecodeError) Error() string {
+	return fmt.Sprintf("gosh: output of command \"%s\" is not valid %s: %s (near %q)", err.Cmdname, err.Format, err.Cause, err.Snippet)
+}
+func (err OutputDecodeError) GoshError() {}
+
+/*
+	RedirectError is raised when launching a command if a file given by
+	a `Redirect` (e.g. `Opts{Out: File("out.log")}`) can't be opened.
+*/
+type RedirectError struct {
+	Path  string
+	Cause error // usually an `*os.PathError`
+}
+
+func (err RedirectError) Error() string {
+	return fmt.Sprintf("gosh: cannot open %q for redirection: %s", err.Path, err.Cause)
+}
+func (err RedirectError) GoshError() {}
+
+/*
+	ExtraFDError is raised when launching a command if something in
+	`Opts.ExtraFD` won't do: e.g. the fd number is one of stdin, stdout or
+	stderr, or there's no telling which way the data should flow.
+*/
+type ExtraFDError struct {
+	FD    int
+	Cause error
+}
+
+func (err ExtraFDError) Error() string {
+	return fmt.Sprintf("gosh: cannot set up fd %d: %s", err.FD, err.Cause)
+}
+func (err ExtraFDError) GoshError() {}
+
+/*
+	NoRecordingError is raised by a `ReplayLauncher` when asked to launch
+	a command it has no (unused) recording of.
+*/
+type NoRecordingError struct {
+	Args []string
+	Cwd  string
+}
+
+func (err NoRecordingError) Error() string {
+	return fmt.Sprintf("gosh: no recording of command %q (in cwd %q)", err.Args, err.Cwd)
+}
+func (err NoRecordingError) GoshError() {}
+
+/*
+	RecordingFileError is raised by `ReplayLauncher` when the golden file
+	can't be read, and reported by `RecordingLauncher.Err()` when it can't
+	be written.
+*/
+type RecordingFileError struct {
+	Path  string
+	Cause error
+}
+
+func (err RecordingFileError) Error() string {
+	return fmt.Sprintf("gosh: cannot use golden file %q: %s", err.Path, err.Cause)
+}
+func (err RecordingFileError) GoshError() {}
+
 /*
 	Error when any of the command templating functions is called with
 	arguments of an unexpected type.  The `interface{}` arguments to command
@@ -120,6 +304,7 @@ func (err ProcMonitorError) GoshError() {}
 		- ClearEnv
 		- string
 		- []string
+		- context.Context
 
 	This should mostly be a compile-time problem as long as you write your
 	script to not actually pass unchecked types of interface{}.
@@ -145,16 +330,64 @@ func whoru(val reflect.Value) string {
 }
 func (err IncomprehensibleCommandModifierError) GoshError() {}
 
+/*
+	CaptureLimitError is raised when a command with an `Opts.Capture` that
+	doesn't make sense (e.g. a negative size other than `CaptureUnlimited`)
+	is run by one of the helpers that captures output.
+*/
+type CaptureLimitError struct {
+	Limit CaptureLimit
+}
+
+func (err CaptureLimitError) Error() string {
+	return fmt.Sprintf("gosh: invalid capture limit (head %d, tail %d): sizes must be CaptureUnlimited or at least zero", err.Limit.Head, err.Limit.Tail)
+}
+func (err CaptureLimitError) GoshError() {}
+
 /*
 	Error for commands run by Sh that exited with a non-successful status.
 
 	What exactly qualifies as an unsuccessful status can be defined per command,
 	but by default is any exit code other than zero.
+
+	`Code` is the status as a shell would report it (so a death by signal is
+	128+signal); `Status` has the unambiguous details.
+
+	`Cmdline` is the whole command, rendered as a line of shell (see
+	`Opts.String()`), for logging what exactly it was that failed.
+	`Error()` includes it too, but with the values of any environment
+	variables left out, since those are so often secrets.
+
+	If the command was a pipeline, `Cmdname` and `Code` describe the stage
+	that failed, and `PipelineStage` says which one it was.  (`Cmdline`
+	is still the whole pipeline.)
 */
 type FailureExitCode struct {
 	Cmdname string
+	Cmdline string
 	Code    int
+	Status  ExitStatus
 	Message string
+
+	// These are only set by `RunAndReport`; see its docs.
+	Stdout string
+	Stderr string
+
+	PipelineStage int // 1-based index of the failed stage if the command was a pipeline; zero otherwise
+
+	transcript      *Transcript // behind a pointer, so the error stays comparable; see `Transcript()`
+	redactedCmdline string      // `Cmdline` without env values, for `Error()`
+}
+
+/*
+	Returns which output went to which stream, in order.  Only set by
+	`RunAndReport`; nil otherwise.
+*/
+func (err FailureExitCode) Transcript() Transcript {
+	if err.transcript == nil {
+		return nil
+	}
+	return *err.transcript
 }
 
 func (err FailureExitCode) Error() string {
@@ -162,6 +395,16 @@ func (err FailureExitCode) Error() string {
 	if err.Message != "" {
 		msg = "\n\tCommand output was:\n\t\t\"\"\"\n\t\t" + strings.Replace(err.Message, "\n", "\n\t\t", -1) + "\n\t\t\"\"\""
 	}
-	return fmt.Sprintf("gosh: command \"%s\" exited with unexpected status %d%s", err.Cmdname, err.Code, msg)
+	if err.redactedCmdline != "" {
+		msg = "\n\tCommand was:\n\t\t" + err.redactedCmdline + msg
+	}
+	stage := ""
+	if err.PipelineStage > 0 {
+		stage = fmt.Sprintf(" (pipeline stage %d)", err.PipelineStage)
+	}
+	if err.Status.Signaled() {
+		return fmt.Sprintf("gosh: command \"%s\"%s was terminated by unexpected %s%s", err.Cmdname, stage, err.Status, msg)
+	}
+	return fmt.Sprintf("gosh: command \"%s\"%s exited with unexpected status %d%s", err.Cmdname, stage, err.Code, msg)
 }
 func (err FailureExitCode) GoshError() {}
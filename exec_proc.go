@@ -1,6 +1,7 @@
 package gosh
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -12,6 +13,12 @@ import (
 
 var _ Proc = &ExecProc{}
 
+/*
+	How long a process gets to exit after being sent the stop signal by `stop`,
+	before it's killed outright, if `Opts.StopGrace` doesn't say otherwise.
+*/
+const defaultStopGrace = 5 * time.Second
+
 /*
 	`gosh.Proc` implementation using `os/exec`.
 */
@@ -49,21 +56,76 @@ type ExecProc struct {
 	*/
 	exitCode int
 
+	/* Exit status, with all the details `exitCode` squashes.  Same rules as `exitCode`. */
+	exitStatus ExitStatus
+
+	/* Resource usage, once we're done.  `Start` is set as soon as the process is launched. */
+	usage ResourceUsage
+
 	/* Functions to call back when the command has exited. */
 	exitListeners []func(Proc)
+
+	/*
+		Functions to call when the process has exited and `cmd.Wait` has
+		drained all its output, but before the proc is marked done --
+		e.g. to flush any output still buffered on our side.
+	*/
+	drainHooks []func()
+
+	/* If set, the process is stopped when this context is done. */
+	ctx context.Context
+
+	/* If nonzero, the process is stopped if it's still running this long after start. */
+	timeout time.Duration
+
+	/* How to stop the process; if unset, SIGTERM and `defaultStopGrace`. */
+	stopSignal os.Signal
+	stopGrace  time.Duration
+
+	/* If set (and the process has a group of its own), `stop` signals the whole group. */
+	stopGroup bool
+
+	/*
+		The process group id, if the process was launched into a group other
+		than our own, or zero if it wasn't.  Set when the process starts.
+	*/
+	pgid int
+
+	/*
+		Set when gosh has decided to stop the process itself (e.g. because
+		`ctx` is done); becomes `err` once the process has exited.
+	*/
+	stopCause error
 }
 
 func ExecProcCmd(cmd *exec.Cmd) Proc {
-	p := &ExecProc{
+	return ExecProcCmdContext(nil, cmd)
+}
+
+/*
+	Like `ExecProcCmd`, but the process is stopped if the context becomes done
+	before the process exits: it's sent SIGTERM, and then killed if it hasn't
+	exited a few seconds later.  The proc then ends in the `CANCELLED` state,
+	with a `CancelledError`.
+
+	A nil context is allowed, and means the same as `ExecProcCmd`.
+*/
+func ExecProcCmdContext(ctx context.Context, cmd *exec.Cmd) Proc {
+	p := newExecProc(cmd)
+	p.ctx = ctx
+	if err := p.start(); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func newExecProc(cmd *exec.Cmd) *ExecProc {
+	return &ExecProc{
 		cmd:      cmd,
 		state:    int32(UNSTARTED),
 		exitCh:   make(chan struct{}),
 		exitCode: -1,
 	}
-	if err := p.start(); err != nil {
-		panic(err)
-	}
-	return p
 }
 
 func (p *ExecProc) State() State {
@@ -102,6 +164,13 @@ func (p *ExecProc) GetExitCode() int {
 	return p.exitCode
 }
 
+func (p *ExecProc) ExitStatus() ExitStatus {
+	if !p.State().IsDone() {
+		p.Wait()
+	}
+	return p.exitStatus
+}
+
 func (p *ExecProc) GetExitCodeSoon(d time.Duration) int {
 	if p.WaitSoon(d) {
 		return p.exitCode
@@ -110,6 +179,20 @@ func (p *ExecProc) GetExitCodeSoon(d time.Duration) int {
 	}
 }
 
+func (p *ExecProc) Err() error {
+	if !p.State().IsDone() {
+		return nil
+	}
+	return p.err
+}
+
+func (p *ExecProc) Usage() ResourceUsage {
+	if !p.State().IsDone() {
+		return ResourceUsage{}
+	}
+	return p.usage
+}
+
 func (p *ExecProc) AddExitListener(callback func(Proc)) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
@@ -136,6 +219,20 @@ func (p *ExecProc) Signal(sig os.Signal) {
 	}
 }
 
+func (p *ExecProc) SignalGroup(sig os.Signal) {
+	if p.pgid == 0 {
+		p.Signal(sig)
+		return
+	}
+	if err := p.signalGroup(sig); err != nil {
+		panic(ProcMonitorError{err})
+	}
+}
+
+func (p *ExecProc) KillGroup() {
+	p.SignalGroup(syscall.SIGKILL)
+}
+
 //
 // Below lieth Guts
 //
@@ -149,6 +246,14 @@ func (p *ExecProc) start() error {
 	}
 
 	atomic.StoreInt32(&p.state, int32(RUNNING))
+	if p.ctx != nil && p.ctx.Err() != nil {
+		p.transitionFinal(CancelledError{
+			Cmdname: p.cmd.Args[0],
+			Cause:   p.ctx.Err(),
+		})
+		return p.err
+	}
+	p.usage.Start = time.Now()
 	if err := p.cmd.Start(); err != nil {
 		// These checks are such an eldrich horror *they can't even fit
 		// into a single switch statement*, because the go standard library
@@ -202,28 +307,151 @@ func (p *ExecProc) start() error {
 		return p.err
 	}
 
+	if attr := p.cmd.SysProcAttr; attr != nil {
+		switch {
+		case attr.Setsid, attr.Setpgid && attr.Pgid == 0:
+			p.pgid = p.cmd.Process.Pid
+		case attr.Setpgid:
+			p.pgid = attr.Pgid
+		}
+	}
+
 	go p.waitAndHandleExit()
+	if p.ctx != nil || p.timeout > 0 {
+		go p.watch()
+	}
+	return nil
+}
+
+func (p *ExecProc) watch() {
+	// nil channels block forever in a select, which is exactly what we want for whatever isn't configured.
+	var ctxDone <-chan struct{}
+	if p.ctx != nil {
+		ctxDone = p.ctx.Done()
+	}
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-p.exitCh:
+	case <-ctxDone:
+		p.stop(CancelledError{
+			Cmdname: p.cmd.Args[0],
+			Cause:   p.ctx.Err(),
+		})
+	case <-timeout:
+		p.stop(TimeoutError{
+			Cmdname: p.cmd.Args[0],
+			Timeout: p.timeout,
+		})
+	}
+}
+
+/*
+	Stops the process on gosh's own initiative: it's sent the stop signal
+	(SIGTERM unless configured otherwise), and if it still hasn't exited
+	after the grace period, it's killed.
+
+	Once the process has exited, `cause` becomes the proc's error.
+	Only the first call has any effect.
+*/
+func (p *ExecProc) stop(cause error) {
+	p.mutex.Lock()
+	if !p.State().IsRunning() || p.stopCause != nil {
+		p.mutex.Unlock()
+		return
+	}
+	p.stopCause = cause
+	p.mutex.Unlock()
+
+	sig, grace := p.stopSignal, p.stopGrace
+	if sig == nil {
+		sig = syscall.SIGTERM
+	}
+	if grace <= 0 {
+		grace = defaultStopGrace
+	}
+
+	// errors are ignored here: the process may well have exited on its own in the meanwhile.
+	if p.stopGroup && p.pgid != 0 {
+		p.signalGroup(sig)
+	} else {
+		p.cmd.Process.Signal(sig)
+	}
+	select {
+	case <-p.exitCh:
+	case <-time.After(grace):
+		if p.stopGroup && p.pgid != 0 {
+			p.signalGroup(syscall.SIGKILL)
+		} else {
+			p.cmd.Process.Kill()
+		}
+	}
+}
+
+/*
+	Runs the drain hooks.  Called once the process's output is finished
+	with: after it's exited, or if it failed to start at all.
+*/
+func (p *ExecProc) drain() {
+	for _, hook := range p.drainHooks {
+		hook()
+	}
+}
+
+/*
+	Signals the process group.  This still works after the process itself
+	has been reaped, for as long as anything is left in the group (the
+	pgid isn't reused until then), which is what makes it useful for
+	cleaning up after children the process left behind.  Once the group
+	is empty, refuses with `os.ErrProcessDone`, as `os.Process.Signal` does.
+*/
+func (p *ExecProc) signalGroup(sig os.Signal) error {
+	ssig, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("cannot send %q to a process group: not a syscall.Signal", sig)
+	}
+	if err := syscall.Kill(-p.pgid, ssig); err != nil {
+		if err == syscall.ESRCH {
+			return os.ErrProcessDone
+		}
+		return err
+	}
 	return nil
 }
 
 func (p *ExecProc) waitAndHandleExit() {
-	exitCode := -1
+	var exitStatus ExitStatus
+	var processState *os.ProcessState
 	var err error
-	for err == nil && exitCode == -1 {
-		exitCode, err = p.waitTry()
+	for err == nil && processState == nil {
+		exitStatus, processState, err = p.waitTry()
 	}
+	end := time.Now()
 
 	// Do one last Wait for good ol' times sake.  And to use the Cmd.closeDescriptors feature.
 	p.cmd.Wait()
+	p.drain()
 
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	p.exitCode = exitCode
+	if processState != nil {
+		p.exitStatus = exitStatus
+		p.exitCode = exitStatus.ShellCode()
+		p.usage = usageFromProcessState(p.usage.Start, end, processState)
+	}
+	if err == nil {
+		err = p.stopCause
+	}
 	p.transitionFinal(err)
 }
 
-func (p *ExecProc) waitTry() (int, error) {
+func (p *ExecProc) waitTry() (ExitStatus, *os.ProcessState, error) {
 	// The docs for os.Process.Wait() state "Wait waits for the Process to exit".
 	// IT LIES.
 	//
@@ -237,17 +465,17 @@ func (p *ExecProc) waitTry() (int, error) {
 	//
 	processState, err := p.cmd.Process.Wait()
 	if err != nil {
-		return -1, err
+		return ExitStatus{}, nil, err
 	}
 
 	if waitStatus, ok := processState.Sys().(syscall.WaitStatus); ok {
 		if waitStatus.Exited() {
-			return waitStatus.ExitStatus(), nil
+			return ExitStatus{Exited: true, Code: waitStatus.ExitStatus()}, processState, nil
 		} else if waitStatus.Signaled() {
 			// In bash, when a processs ends from a signal, the $? variable is set to 128+SIG.
-			// We follow that same convention here.
+			// We follow that same convention for the exit code (see `ExitStatus.ShellCode`).
 			// So, a process terminated by ctrl-C returns 130.  A script that died to kill-9 returns 137.
-			return int(waitStatus.Signal()) + 128, nil
+			return ExitStatus{Signal: waitStatus.Signal(), CoreDumped: waitStatus.CoreDump()}, processState, nil
 		} else {
 			// This should be more or less unreachable.
 			//  ... the operative word there being "should".  Read: "you wish".
@@ -256,8 +484,8 @@ func (p *ExecProc) waitTry() (int, error) {
 			//  syscall.Wait4 being called with WUNTRACED or WCONTINUED.
 			// However, syscall.Wait4 may also return the Continued and Stoppe states if ptrace() has been attached to the child,
 			//  so, really, anything is possible here.
-			// And thus, we have to return a special code here that causes wait to be tried in a loop.
-			return -1, nil
+			// And thus, we have to return without a process state here, which causes wait to be tried in a loop.
+			return ExitStatus{}, nil, nil
 		}
 	} else {
 		panic(fmt.Errorf("gosh only works systems with posix-style process semantics."))
@@ -272,7 +500,12 @@ func (p *ExecProc) transitionFinal(err error) {
 			atomic.StoreInt32(&p.state, int32(FINISHED))
 		} else {
 			p.err = err
-			atomic.StoreInt32(&p.state, int32(PANICKED))
+			switch err.(type) {
+			case CancelledError, TimeoutError:
+				atomic.StoreInt32(&p.state, int32(CANCELLED))
+			default:
+				atomic.StoreInt32(&p.state, int32(PANICKED))
+			}
 		}
 		// iterate over exit listeners
 		for _, cb := range p.exitListeners {
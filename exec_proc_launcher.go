@@ -1,8 +1,11 @@
 package gosh
 
 import (
-	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"reflect"
+	"syscall"
 
 	"github.com/polydawn/gosh/iox"
 )
@@ -42,25 +45,93 @@ func execLauncher(cmdt Opts, trailingHook func(*exec.Cmd)) Proc {
 		cmd.Dir = cmdt.Cwd
 	}
 
+	// our copies of any file descriptors handed to the child are closed once it's launched
+	var closeAfterStart []io.Closer
+	defer func() {
+		for _, c := range closeAfterStart {
+			c.Close()
+		}
+	}()
+
 	// set up io (stdin/stdout/stderr)
+	var upstream Proc
+	var upstreamOpts Opts
 	if cmdt.In != nil {
 		switch in := cmdt.In.(type) {
 		case Command:
-			//TODO something marvelous
-			panic(fmt.Errorf("not yet implemented"))
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				panic(ProcMonitorError{Cause: err})
+			}
+			closeAfterStart = append(closeAfterStart, pr, pw)
+			upstreamOpts = in.expose().inheritStopping(cmdt)
+			upstreamOpts.Out = pw
+			upstream = upstreamOpts.start()
+			// the upstream's launcher may be writing into the pipe itself (a recorder's tee, say),
+			// so our end stays open until the upstream is done with it.
+			closeAfterStart = closeAfterStart[:len(closeAfterStart)-1]
+			upstream.AddExitListener(func(Proc) { pw.Close() })
+			cmd.Stdin = pr
+		case Redirect:
+			f := in.open(false)
+			closeAfterStart = append(closeAfterStart, f)
+			cmd.Stdin = f
 		default:
 			cmd.Stdin = iox.ReaderFromInterface(in)
 		}
 	}
-	if cmdt.Out != nil {
-		cmd.Stdout = iox.WriterFromInterface(cmdt.Out)
+	if upstream != nil {
+		// if we can't launch our half of the pipeline, don't leave the other half dangling
+		defer func() {
+			if err := recover(); err != nil {
+				if !upstream.State().IsDone() {
+					// it may still exit before the kill lands; either way, it's our error that matters
+					func() {
+						defer func() { recover() }()
+						upstream.Kill()
+					}()
+				}
+				panic(err)
+			}
+		}()
 	}
-	if cmdt.Err != nil {
-		if cmdt.Err == cmdt.Out {
-			cmd.Stderr = cmd.Stdout
-		} else {
-			cmd.Stderr = iox.WriterFromInterface(cmdt.Err)
+	outputs := setupOutputs(cmdt)
+	cmd.Stdout, cmd.Stderr = outputs.out, outputs.err
+	// until it's settled below who closes the files, it's up to us if anything goes wrong
+	filesSettled := false
+	defer func() {
+		if err := recover(); err != nil {
+			if !filesSettled {
+				for _, f := range outputs.files {
+					f.Close()
+				}
+			}
+			panic(err)
 		}
+	}()
+
+	// set up extra file descriptors
+	var extra *extraFDs
+	if len(cmdt.ExtraFD) > 0 {
+		extra = setupExtraFDs(cmdt.ExtraFD)
+		closeAfterStart = append(closeAfterStart, extra.childEnds...)
+		cmd.ExtraFiles = extra.files
+		defer func() {
+			if err := recover(); err != nil {
+				if extra != nil {
+					extra.abort()
+				}
+				panic(err)
+			}
+		}()
+	}
+
+	// set up process group
+	switch cmdt.ProcGroup {
+	case ProcGroupNew:
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	case ProcGroupSession:
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 	}
 
 	// hook, down here it's your time
@@ -69,5 +140,197 @@ func execLauncher(cmdt Opts, trailingHook func(*exec.Cmd)) Proc {
 	}
 
 	// go time
-	return ExecProcCmd(cmd)
+	p := newExecProc(cmd)
+	if extra != nil {
+		// output on the extra fds has to be all in before anything's flushed or closed
+		p.drainHooks = append(p.drainHooks, extra.wait)
+	}
+	p.drainHooks = append(p.drainHooks, outputs.drainHooks...)
+	// after the hook, since it may have wrapped them too
+	closeAfterStart = append(closeAfterStart, outputs.closeFiles(cmd, &p.drainHooks)...)
+	filesSettled = true
+	p.ctx = cmdt.Context
+	p.timeout = cmdt.Timeout
+	p.stopSignal = cmdt.StopSignal
+	p.stopGrace = cmdt.StopGrace
+	p.stopGroup = cmdt.StopGroup
+	if err := p.start(); err != nil {
+		if extra != nil {
+			extra.abort()
+			extra = nil // don't abort twice on the way out
+		}
+		p.drain()
+		panic(err)
+	}
+	if extra != nil {
+		extra.start()
+	}
+	if upstream != nil {
+		return JoinPipeline(upstream, upstreamOpts, p, cmdt)
+	}
+	return p
+}
+
+/*
+	Fills in how an upstream pipeline stage is to be stopped -- its
+	`Context`, `Timeout`, `StopSignal` and `StopGrace` -- from the stage
+	it feeds, wherever the upstream command doesn't say for itself.
+	(Otherwise a timeout on the pipeline would stop the upstream stages
+	with the default signal and grace period.)
+*/
+func (cmdt Opts) inheritStopping(downstream Opts) Opts {
+	if cmdt.Context == nil {
+		cmdt.Context = downstream.Context
+	}
+	if cmdt.Timeout == 0 {
+		cmdt.Timeout = downstream.Timeout
+	}
+	if cmdt.StopSignal == nil {
+		cmdt.StopSignal = downstream.StopSignal
+	}
+	if cmdt.StopGrace == 0 {
+		cmdt.StopGrace = downstream.StopGrace
+	}
+	return cmdt
+}
+
+/*
+	The writers a process's stdout and stderr go to, as set up from `Opts`,
+	and what needs doing once the process is done writing to them.
+*/
+type outputSinks struct {
+	out, err   io.Writer  // nil if output is to be discarded
+	files      []*os.File // files opened for `Redirect`s; see `closeFiles()`
+	drainHooks []func()   // run these, in order, once all output is in
+}
+
+func setupOutputs(cmdt Opts) (s outputSinks) {
+	defer func() {
+		if err := recover(); err != nil {
+			for _, f := range s.files {
+				f.Close()
+			}
+			panic(err)
+		}
+	}()
+
+	writer := func(sink interface{}) io.Writer {
+		if r, ok := sink.(Redirect); ok {
+			f := r.open(true)
+			s.files = append(s.files, f)
+			return f
+		}
+		return iox.WriterFromInterface(sink)
+	}
+	var stdout, stderr io.Writer
+	if cmdt.Out != nil {
+		stdout = writer(cmdt.Out)
+	}
+	if cmdt.Err != nil {
+		if sameSink(cmdt.Err, cmdt.Out) {
+			stderr = stdout
+		} else {
+			stderr = writer(cmdt.Err)
+		}
+	}
+	s.out, s.err = stdout, stderr
+
+	if cmdt.Decorate.enabled() {
+		// each stream gets its own decorator, so partial lines on one don't get mixed into the other
+		for _, w := range []*io.Writer{&s.out, &s.err} {
+			if *w != nil {
+				d := cmdt.Decorate.wrap(*w, cmdt.Args[0])
+				s.drainHooks = append(s.drainHooks, func() { d.Close() })
+				*w = d
+			}
+		}
+	}
+	for _, w := range []io.Writer{stdout, stderr} {
+		if w != nil {
+			w := w
+			s.drainHooks = append(s.drainHooks, func() { flushBuffered(w) })
+		}
+	}
+	var closers []io.Closer
+	if c := chanCloser(cmdt.Out, stdout); cmdt.CloseOut && c != nil {
+		closers = append(closers, c)
+	}
+	if c := chanCloser(cmdt.Err, stderr); cmdt.CloseErr && c != nil && !(cmdt.CloseOut && stderr == stdout) {
+		closers = append(closers, c)
+	}
+	for _, c := range closers {
+		c := c
+		s.drainHooks = append(s.drainHooks, func() { c.Close() })
+	}
+	return s
+}
+
+/*
+	Sorts out when the files opened for `Redirect`s get closed.  Those
+	handed to the child as they are are returned, to be closed as soon as
+	it's launched, since it has its own copies; those wrapped in something
+	of ours (a decorator, say) are still being written by us until all the
+	output is in, so they're closed by drain hooks, after the wrappers are
+	flushed.
+*/
+func (s outputSinks) closeFiles(cmd *exec.Cmd, drainHooks *[]func()) (closeAfterStart []io.Closer) {
+	for _, f := range s.files {
+		f := f
+		if cmd.Stdout == io.Writer(f) || cmd.Stderr == io.Writer(f) {
+			closeAfterStart = append(closeAfterStart, f)
+		} else {
+			*drainHooks = append(*drainHooks, func() { f.Close() })
+		}
+	}
+	return
+}
+
+/*
+	Returns what to close for `Opts.CloseOut` (or `CloseErr`), given the
+	sink and the writer made from it: the writer itself if the sink is a
+	channel, or if it's a tee (which closes only its channel sinks);
+	otherwise nil, since other sinks are never closed.
+*/
+func chanCloser(sink interface{}, w io.Writer) io.Closer {
+	if iox.IsChanSink(sink) {
+		return w.(io.Closer)
+	}
+	if t, ok := w.(*iox.TeeWriter); ok {
+		return t
+	}
+	return nil
+}
+
+/*
+	Reports whether two Out/Err sinks are the same thing, so they can share
+	one writer.  (Not just `==`, which panics on uncomparable things like
+	the `[]interface{}` of a tee.)
+*/
+func sameSink(a, b interface{}) bool {
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb {
+		return false
+	}
+	if ta.Comparable() {
+		return a == b
+	}
+	if ta.Kind() == reflect.Slice {
+		va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+		return va.Pointer() == vb.Pointer() && va.Len() == vb.Len()
+	}
+	return false
+}
+
+/*
+	Flushes the writers from iox that hold on to output: line-framing
+	writers keep any unterminated last line until told otherwise, and tees
+	may have output still queued for channels.
+*/
+func flushBuffered(w io.Writer) {
+	switch w2 := w.(type) {
+	case *iox.RecordWriter:
+		w2.Flush()
+	case *iox.TeeWriter:
+		w2.Flush()
+	}
 }
@@ -185,6 +185,17 @@ func TestProcExec(t *testing.T) {
 		Convey("The exit code should be reported accurately", FailureContinues, func() {
 			So(p.GetExitCode(), ShouldEqual, 22)
 			So(p.State(), ShouldEqual, FINISHED)
+			So(p.ExitStatus(), ShouldResemble, ExitStatus{Exited: true, Code: 22})
+		})
+	})
+
+	Convey("Given commands that exit with codes that look like signals", t, func() {
+		cmd := nilifyFDs(exec.Command("sh", []string{"-c", "exit 137"}...))
+		p := ExecProcCmd(cmd)
+		Convey("The exit status should not be mistaken for a signal", FailureContinues, func() {
+			So(p.GetExitCode(), ShouldEqual, 137)
+			So(p.ExitStatus(), ShouldResemble, ExitStatus{Exited: true, Code: 137})
+			So(p.ExitStatus().Signaled(), ShouldBeFalse)
 		})
 	})
 
@@ -200,6 +211,10 @@ func TestProcExec(t *testing.T) {
 				So(code, ShouldEqual, 128+9)
 				So(p.State(), ShouldEqual, FINISHED)
 			})
+			Convey("Proc exit status should report the signal", FailureContinues, func() {
+				So(p.ExitStatus(), ShouldResemble, ExitStatus{Signal: syscall.SIGKILL})
+				So(p.ExitStatus().Signaled(), ShouldBeTrue)
+			})
 		})
 	})
 
@@ -207,3 +222,27 @@ func TestProcExec(t *testing.T) {
 		// TODO
 	})
 }
+
+func TestProcUsage(t *testing.T) {
+	Convey("Given a command that burns some CPU", t, func() {
+		cmd := nilifyFDs(exec.Command("sh", "-c", "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done"))
+		tStart := time.Now()
+		p := ExecProcCmd(cmd)
+
+		Convey("Usage should be unavailable until it's done", func() {
+			if !p.State().IsDone() {
+				So(p.Usage(), ShouldResemble, ResourceUsage{})
+			}
+		})
+		Convey("Usage should be reported once it's done", FailureContinues, func() {
+			p.Wait()
+			u := p.Usage()
+			So(u.Start, ShouldHappenOnOrAfter, tStart)
+			So(u.End, ShouldHappenAfter, u.Start)
+			So(u.WallTime(), ShouldBeGreaterThan, 0)
+			So(u.UserTime+u.SystemTime, ShouldBeGreaterThan, 0)
+			So(u.MaxRSS, ShouldBeGreaterThan, 1024)
+			So(u.MinorFaults, ShouldBeGreaterThan, 0)
+		})
+	})
+}
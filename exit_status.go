@@ -0,0 +1,102 @@
+package gosh
+
+import (
+	"fmt"
+	"syscall"
+)
+
+/*
+	ExitStatus describes how a process ended: either it exited normally with
+	an exit code, or it was terminated by a signal.
+
+	This is more precise than the single integer of `Proc.GetExitCode()`,
+	which follows the shell convention of reporting a death by signal as
+	128+signal -- and thus can't tell a process that was killed by SIGKILL
+	apart from one that really called `exit(137)`.
+
+	If the status couldn't be determined (e.g. the proc is PANICKED), the
+	zero value is used: neither `Exited` nor any `Signal`.
+*/
+type ExitStatus struct {
+	Exited     bool           // true if the process exited normally (i.e. called exit)
+	Code       int            // the exit code, if `Exited`
+	Signal     syscall.Signal // the signal that terminated the process, if it didn't exit normally
+	CoreDumped bool           // true if the process was terminated by a signal and dumped core
+}
+
+/*
+	Returns true if the process was terminated by a signal.
+*/
+func (s ExitStatus) Signaled() bool {
+	return !s.Exited && s.Signal != 0
+}
+
+/*
+	Returns the status as a shell would report it in `$?`: the exit code if
+	the process exited normally, or 128+signal if it was terminated by one.
+	Returns -1 if the status is unknown.
+
+	This is the same number `Proc.GetExitCode()` reports.
+*/
+func (s ExitStatus) ShellCode() int {
+	switch {
+	case s.Exited:
+		return s.Code
+	case s.Signaled():
+		return int(s.Signal) + 128
+	default:
+		return -1
+	}
+}
+
+func (s ExitStatus) String() string {
+	switch {
+	case s.Exited:
+		return fmt.Sprintf("exit status %d", s.Code)
+	case s.Signaled() && s.CoreDumped:
+		return fmt.Sprintf("signal %d (%s) (core dumped)", s.Signal, s.Signal)
+	case s.Signaled():
+		return fmt.Sprintf("signal %d (%s)", s.Signal, s.Signal)
+	default:
+		return "unknown status"
+	}
+}
+
+/*
+	Returns a value for use in `Opts.OkExit` which accepts death by the given
+	signal as success.
+
+	For example, `Opts{OkExit: []int{0, SignalExit(syscall.SIGPIPE)}}` is useful
+	for the early stages of pipelines like `yes | head -n1`, where the later
+	stage is expected to stop reading before the earlier one is done writing.
+*/
+func SignalExit(sig syscall.Signal) int {
+	return -int(sig)
+}
+
+/*
+	Checks an exit status against a list of acceptable exit codes (as in
+	`Opts.OkExit`).  A process that exited normally is checked by its exit code;
+	one that was terminated by a signal is accepted if the list includes either
+	the corresponding `SignalExit()` value, or its shell code (128+signal), as
+	gosh has always reported signal deaths.
+*/
+func isOkExit(okExit []int, status ExitStatus) bool {
+	var want []int
+	switch {
+	case status.Exited:
+		want = []int{status.Code}
+	case status.Signaled():
+		want = []int{SignalExit(status.Signal), status.ShellCode()}
+	default:
+		return false
+	}
+	for _, okcode := range okExit {
+		for _, w := range want {
+			if w == okcode {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package gosh
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+/*
+	Expecter drives an interactive program, in the style of the venerable
+	`expect` tool: wait for output matching a pattern, send a response,
+	repeat.  Everything sent and received is kept in a `Transcript`.
+
+	Get one from `Command.Expect()`.
+
+	Output is accumulated as it arrives, and each `Expect` call searches
+	whatever hasn't yet been consumed by a previous match; everything up to
+	the end of a match is consumed.  (Beware that patterns are matched against
+	output as it arrives, so a pattern like `\d+` may match only the first
+	few digits of a number if the rest hasn't arrived yet.)
+
+	Stdout and stderr are merged.  If the command is launched with
+	`PtyLauncher`, the expecter talks to the terminal instead, which
+	many interactive programs will be happier with.
+
+	As with the rest of gosh, problems are raised as panics: a pattern not
+	showing up in time is an `ExpectTimeoutError`, and the output ending
+	without it showing up is an `ExpectEOFError`.
+*/
+type Expecter struct {
+	cmdt Opts
+	proc Proc
+
+	in      io.Writer
+	closeIn func() error
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	/* Output received and not yet consumed by a match. */
+	buf []byte
+
+	/* Set when the output has ended. */
+	eof bool
+
+	transcript Transcript
+
+	/* Closed when we've read all the output there will ever be. */
+	readDone chan struct{}
+}
+
+/*
+	Starts the command, and returns an `Expecter` for interacting with it.
+
+	The command's `In`, `Out`, and `Err` are replaced; the Expecter handles
+	all of them.
+*/
+func (c Command) Expect() *Expecter {
+	cmdt := c.expose()
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		panic(ProcMonitorError{Cause: err})
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		panic(ProcMonitorError{Cause: err})
+	}
+	launched := false
+	defer func() {
+		// the child has its own copies of its ends of the pipes (or none at all, if launch failed);
+		// and if launch failed, we're done with ours too.
+		inR.Close()
+		outW.Close()
+		if !launched {
+			inW.Close()
+			outR.Close()
+		}
+	}()
+	cmdt.In, cmdt.Out, cmdt.Err = inR, outW, outW
+	p := cmdt.start()
+	launched = true
+
+	e := &Expecter{
+		cmdt:     cmdt,
+		proc:     p,
+		readDone: make(chan struct{}),
+	}
+	e.cond = sync.NewCond(&e.mutex)
+	if term, ok := ptyOf(p); ok {
+		// the pty launcher doesn't use the pipes; talk to the terminal instead.
+		inW.Close()
+		outR.Close()
+		e.in, e.closeIn = term.In(), term.Close
+		go e.read(term.Out(), nil)
+	} else {
+		e.in, e.closeIn = inW, inW.Close
+		go e.read(outR, outR)
+	}
+	return e
+}
+
+/*
+	The master side of a pseudo-terminal, as far as an Expecter needs it.
+	(See `ptyOf`; on Linux, this is a `*PtyProc`.)
+*/
+type terminal interface {
+	In() io.Writer
+	Out() io.Reader
+	Close() error
+}
+
+/*
+	Returns the proc of the command being driven.
+*/
+func (e *Expecter) Proc() Proc {
+	return e.proc
+}
+
+/*
+	Waits until output matching the pattern shows up, and returns the match
+	(and any submatches) as with `regexp.FindStringSubmatch`.
+
+	Panics with an `ExpectTimeoutError` if there's no match within the
+	timeout, or an `ExpectEOFError` if the output ends without a match.
+*/
+func (e *Expecter) Expect(pattern string, timeout time.Duration) []string {
+	return e.ExpectRegexp(regexp.MustCompile(pattern), timeout)
+}
+
+/*
+	Same as `Expect()`, but with a compiled regexp.
+*/
+func (e *Expecter) ExpectRegexp(re *regexp.Regexp, timeout time.Duration) []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	expired := false
+	timer := time.AfterFunc(timeout, func() {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+		expired = true
+		e.cond.Broadcast()
+	})
+	defer timer.Stop()
+
+	for {
+		if loc := re.FindSubmatchIndex(e.buf); loc != nil {
+			match := make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = string(e.buf[loc[2*i]:loc[2*i+1]])
+				}
+			}
+			e.buf = e.buf[loc[1]:]
+			return match
+		}
+		switch {
+		case e.eof:
+			panic(ExpectEOFError{Pattern: re.String(), Unmatched: string(e.buf)})
+		case expired:
+			panic(ExpectTimeoutError{Pattern: re.String(), Timeout: timeout, Unmatched: string(e.buf)})
+		}
+		e.cond.Wait()
+	}
+}
+
+/*
+	Waits until the output ends (i.e. the command has exited, or at least
+	closed its output), and returns whatever output hadn't been consumed yet.
+
+	Panics with an `ExpectTimeoutError` if the output hasn't ended within the timeout.
+*/
+func (e *Expecter) ExpectEOF(timeout time.Duration) string {
+	select {
+	case <-e.readDone:
+	case <-time.After(timeout):
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+		panic(ExpectTimeoutError{Timeout: timeout, Unmatched: string(e.buf)})
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	rest := string(e.buf)
+	e.buf = nil
+	return rest
+}
+
+/*
+	Sends a string to the command's input.
+*/
+func (e *Expecter) Send(s string) {
+	e.mutex.Lock()
+	e.transcript = append(e.transcript, TranscriptEntry{Time: time.Now(), Stream: StreamIn, Data: s})
+	e.mutex.Unlock()
+	if _, err := io.WriteString(e.in, s); err != nil {
+		panic(ProcMonitorError{Cause: err})
+	}
+}
+
+/*
+	Sends a string followed by a newline to the command's input.
+*/
+func (e *Expecter) SendLine(s string) {
+	e.Send(s + "\n")
+}
+
+/*
+	Closes the command's input, so it will see EOF.
+	(If the command is on a terminal, this hangs up the terminal instead;
+	consider sending a ctrl-D ("\x04") if that's not what you want.)
+*/
+func (e *Expecter) CloseInput() {
+	e.closeIn()
+}
+
+/*
+	Waits for the command to exit and for all its output to be read, then
+	checks its exit status just like `Command.Run()` does (panicking with a
+	`FailureExitCode` if it's not acceptable), and returns the proc.
+*/
+func (e *Expecter) Wait() Proc {
+	e.proc.Wait()
+	<-e.readDone
+	e.closeIn()
+	if err := e.cmdt.wait(e.proc); err != nil {
+		panic(err)
+	}
+	return e.proc
+}
+
+/*
+	Returns a copy of everything sent to and received from the command so far.
+*/
+func (e *Expecter) Transcript() Transcript {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append(Transcript(nil), e.transcript...)
+}
+
+func (e *Expecter) read(r io.Reader, closer io.Closer) {
+	defer close(e.readDone)
+	if closer != nil {
+		defer closer.Close()
+	}
+	chunk := make([]byte, 4096)
+	for {
+		n, err := r.Read(chunk)
+		e.mutex.Lock()
+		if n > 0 {
+			e.buf = append(e.buf, chunk[:n]...)
+			e.transcript = append(e.transcript, TranscriptEntry{Time: time.Now(), Stream: StreamOut, Data: string(chunk[:n])})
+		}
+		if err != nil {
+			e.eof = true
+		}
+		e.cond.Broadcast()
+		e.mutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
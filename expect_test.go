@@ -0,0 +1,70 @@
+package gosh
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExpect(t *testing.T) {
+	script := `printf "name? "; read n; echo "hello $n"; printf "again? "; read m; echo "bye $m"`
+
+	Convey("Given an interactive command", t, func() {
+		e := Gosh("sh", "-c", script).Expect()
+
+		Convey("We should be able to script a conversation", func() {
+			e.Expect(`name\? `, 1*time.Second)
+			e.SendLine("bob")
+			So(e.Expect(`hello (\w+)\n`, 1*time.Second), ShouldResemble, []string{"hello bob\n", "bob"})
+			e.Expect(`again\? `, 1*time.Second)
+			e.SendLine("alice")
+			So(e.ExpectEOF(1*time.Second), ShouldEqual, "bye alice\n")
+			So(e.Wait().GetExitCode(), ShouldEqual, 0)
+
+			Convey("The transcript should have both sides", func() {
+				So(e.Transcript().String(), ShouldEqual, strings.Join([]string{
+					"out| name? ",
+					" in| bob",
+					"out| hello bob",
+					"out| again? ",
+					" in| alice",
+					"out| bye alice",
+					"",
+				}, "\n"))
+			})
+		})
+		Convey("Expecting output that doesn't come should time out", func() {
+			defer e.Proc().Kill()
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, ExpectTimeoutError{})
+				So(err.(ExpectTimeoutError).Unmatched, ShouldEqual, "name? ")
+			}()
+			e.Expect("never", 50*time.Millisecond)
+		})
+		Convey("Expecting output after the end should fail", func() {
+			e.CloseInput()
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, ExpectEOFError{})
+				So(err.(ExpectEOFError).Unmatched, ShouldStartWith, "name? hello")
+			}()
+			e.Expect("never", 1*time.Second)
+		})
+	})
+
+	Convey("Given an interactive command that fails", t, func() {
+		e := Gosh("sh", "-c", "read x; exit 3").Expect()
+
+		Convey("Wait should check the exit code", func() {
+			e.SendLine("")
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+			}()
+			e.Wait()
+		})
+	})
+}
@@ -0,0 +1,175 @@
+package gosh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/polydawn/gosh/iox"
+)
+
+/*
+	Marks a value in `Opts.ExtraFD` as something for the process to read
+	from, for when that's not obvious from its type (e.g. a `chan string`,
+	or an `io.ReadWriter`, which could go either way).
+*/
+func ExtraIn(src interface{}) interface{} {
+	return extraFD{src, true}
+}
+
+/*
+	Marks a value in `Opts.ExtraFD` as something for the process to write
+	to, for when that's not obvious from its type.  See `ExtraIn`.
+*/
+func ExtraOut(sink interface{}) interface{} {
+	return extraFD{sink, false}
+}
+
+type extraFD struct {
+	x     interface{}
+	input bool
+}
+
+/*
+	Works out which way data flows for a value in `Opts.ExtraFD`.
+	Returns false for `ok` if there's no telling.
+*/
+func extraFDDirection(x interface{}) (input bool, ok bool) {
+	switch y := x.(type) {
+	case extraFD:
+		return y.input, true
+	case string, []byte, <-chan string, <-chan []byte:
+		return true, true
+	case chan<- string, chan<- []byte, []interface{}, *bytes.Buffer:
+		// (a buffer could be read from too, but collecting output is what it's usually for)
+		return false, true
+	case io.Reader:
+		_, alsoWriter := y.(io.Writer)
+		return true, !alsoWriter
+	case io.Writer:
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+/*
+	The plumbing for a process's `Opts.ExtraFD`: the files to hand the
+	child, and the goroutines pumping data to and from them.
+*/
+type extraFDs struct {
+	files       []*os.File  // for `exec.Cmd.ExtraFiles`
+	childEnds   []io.Closer // our copies of what the child gets; close once it's started
+	parentEnds  []io.Closer // our ends of the pipes; the pumps close these
+	pumps       []func()
+	outputsDone []chan struct{}
+}
+
+/*
+	Opens files and makes pipes for each extra fd.  Panics with an
+	`ExtraFDError` (or `RedirectError`) if any of them won't do.
+*/
+func setupExtraFDs(fds map[int]interface{}) (x *extraFDs) {
+	x = &extraFDs{}
+	defer func() {
+		if err := recover(); err != nil {
+			x.abort()
+			for _, c := range x.childEnds {
+				c.Close()
+			}
+			panic(err)
+		}
+	}()
+
+	maxFD := 2
+	for fd := range fds {
+		if fd < 3 {
+			panic(ExtraFDError{FD: fd, Cause: fmt.Errorf("fds 0, 1 and 2 are In, Out and Err")})
+		}
+		if fd > maxFD {
+			maxFD = fd
+		}
+	}
+	x.files = make([]*os.File, maxFD-2) // any gaps are closed in the child
+	for fd, v := range fds {
+		x.files[fd-3] = x.setup(fd, v)
+	}
+	return x
+}
+
+func (x *extraFDs) setup(fd int, v interface{}) *os.File {
+	switch y := v.(type) {
+	case *os.File:
+		return y
+	case Redirect:
+		f := y.open(y.mode != redirectRead)
+		x.childEnds = append(x.childEnds, f)
+		return f
+	}
+	input, ok := extraFDDirection(v)
+	if !ok {
+		panic(ExtraFDError{FD: fd, Cause: fmt.Errorf("can't tell whether %T is for input or output; use ExtraIn or ExtraOut", v)})
+	}
+	if ef, ok := v.(extraFD); ok {
+		v = ef.x
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		panic(ProcMonitorError{Cause: err})
+	}
+	if input {
+		r := iox.ReaderFromInterface(v)
+		x.childEnds = append(x.childEnds, pr)
+		x.parentEnds = append(x.parentEnds, pw)
+		x.pumps = append(x.pumps, func() {
+			io.Copy(pw, r) // errors here just mean the process stopped reading
+			pw.Close()
+		})
+		return pr
+	}
+	w := iox.WriterFromInterface(v)
+	done := make(chan struct{})
+	x.childEnds = append(x.childEnds, pw)
+	x.parentEnds = append(x.parentEnds, pr)
+	x.outputsDone = append(x.outputsDone, done)
+	x.pumps = append(x.pumps, func() {
+		defer close(done)
+		io.Copy(w, pr)
+		pr.Close()
+		flushBuffered(w)
+	})
+	return pw
+}
+
+/*
+	Starts the pumps.  Call once the process is started.
+*/
+func (x *extraFDs) start() {
+	for _, pump := range x.pumps {
+		go pump()
+	}
+}
+
+/*
+	Waits for the pumps reading output from the process to finish.
+	(Pumps feeding input to it finish by themselves when it exits.)
+*/
+func (x *extraFDs) wait() {
+	for _, done := range x.outputsDone {
+		<-done
+	}
+}
+
+/*
+	Cleans up if the process is never started.
+*/
+func (x *extraFDs) abort() {
+	for _, c := range x.parentEnds {
+		c.Close()
+	}
+	for _, done := range x.outputsDone {
+		close(done)
+	}
+	x.pumps = nil
+}
@@ -0,0 +1,266 @@
+package goshtest
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/polydawn/gosh"
+)
+
+var _ gosh.Proc = &FakeProc{}
+
+/*
+	`gosh.Proc` implementation that's entirely in memory, and moves from
+	state to state only when told to.  Use it to unit test code that
+	consumes Procs, without running any real processes.
+
+	A new FakeProc is UNSTARTED, with a pid of -1.  `Start` makes it
+	RUNNING; `Exit`, `ExitWith`, `Panic`, and `Cancel` make it done.
+	Exit listeners are called just as `gosh.Proc` documents: after the
+	state and exit status are final, and before any `Wait` returns.
+
+	Signals sent to it (including by `Kill`) are recorded, and otherwise
+	do nothing unless `OnSignal` is set.
+*/
+type FakeProc struct {
+	/*
+		If set, called (without any locks held) with each signal the proc
+		is sent, after it's recorded.  It may e.g. call `ExitWith` to
+		play the part of a process that dies when signalled.
+	*/
+	OnSignal func(p *FakeProc, sig os.Signal)
+
+	/* Guards all transitions, same as in `gosh.ExecProc`. */
+	mutex sync.Mutex
+
+	/* Always access this with functions from the atomic package. */
+	state int32
+
+	/* Set before `state` leaves UNSTARTED; -1 until then. */
+	pid int
+
+	err error
+
+	exitStatus gosh.ExitStatus
+
+	usage gosh.ResourceUsage
+
+	exitCh chan struct{}
+
+	exitListeners []func(gosh.Proc)
+
+	/* Guards the signal log, separately, so listeners can look at it. */
+	sigMutex     sync.Mutex
+	signals      []os.Signal
+	groupSignals []bool // parallel to `signals`; true if sent to the group
+}
+
+func NewFakeProc() *FakeProc {
+	return &FakeProc{
+		exitCh: make(chan struct{}),
+	}
+}
+
+/*
+	Moves the proc to RUNNING, with the given pid.  Does nothing if it's
+	already been started.
+*/
+func (p *FakeProc) Start(pid int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.State().IsStarted() {
+		return
+	}
+	p.pid = pid
+	p.usage.Start = time.Now()
+	atomic.StoreInt32(&p.state, int32(gosh.RUNNING))
+}
+
+/*
+	Finishes the proc as a process exiting normally with `code`.
+	See `ExitWith`.
+*/
+func (p *FakeProc) Exit(code int) {
+	p.ExitWith(gosh.ExitStatus{Exited: true, Code: code})
+}
+
+/*
+	Finishes the proc with the given exit status: the state becomes
+	FINISHED, exit listeners are called, and waits return.
+
+	If the proc wasn't started yet, it's started first (with pid 0).
+	Does nothing if it's already done.
+*/
+func (p *FakeProc) ExitWith(status gosh.ExitStatus) {
+	p.transitionFinal(gosh.FINISHED, status, nil)
+}
+
+/*
+	Finishes the proc in the PANICKED state, with `err` (which should be a
+	`gosh.Error`) as its `Err()`.  The exit status is unknown.
+*/
+func (p *FakeProc) Panic(err error) {
+	p.transitionFinal(gosh.PANICKED, gosh.ExitStatus{}, err)
+}
+
+/*
+	Finishes the proc in the CANCELLED state, with `err` (which should be a
+	`gosh.CancelledError` or `gosh.TimeoutError`) as its `Err()`, and
+	the given exit status.
+*/
+func (p *FakeProc) Cancel(err error, status gosh.ExitStatus) {
+	p.transitionFinal(gosh.CANCELLED, status, err)
+}
+
+/*
+	Returns the signals the proc has been sent so far, in order, whether
+	directly or to its group.
+*/
+func (p *FakeProc) Signals() []os.Signal {
+	p.sigMutex.Lock()
+	defer p.sigMutex.Unlock()
+	return append([]os.Signal(nil), p.signals...)
+}
+
+/*
+	Returns the signals the proc has been sent to its whole group
+	(by `SignalGroup` or `KillGroup`) so far, in order.
+*/
+func (p *FakeProc) GroupSignals() []os.Signal {
+	p.sigMutex.Lock()
+	defer p.sigMutex.Unlock()
+	var sigs []os.Signal
+	for i, sig := range p.signals {
+		if p.groupSignals[i] {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+func (p *FakeProc) State() gosh.State {
+	return gosh.State(atomic.LoadInt32(&p.state))
+}
+
+func (p *FakeProc) Pid() int {
+	if !p.State().IsStarted() {
+		return -1
+	}
+	return p.pid
+}
+
+func (p *FakeProc) WaitChan() <-chan struct{} {
+	return p.exitCh
+}
+
+func (p *FakeProc) Wait() {
+	<-p.WaitChan()
+}
+
+func (p *FakeProc) WaitSoon(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return false
+	case <-p.WaitChan():
+		return true
+	}
+}
+
+func (p *FakeProc) GetExitCode() int {
+	p.Wait()
+	return p.exitStatus.ShellCode()
+}
+
+func (p *FakeProc) GetExitCodeSoon(d time.Duration) int {
+	if p.WaitSoon(d) {
+		return p.exitStatus.ShellCode()
+	} else {
+		return -1
+	}
+}
+
+func (p *FakeProc) ExitStatus() gosh.ExitStatus {
+	p.Wait()
+	return p.exitStatus
+}
+
+func (p *FakeProc) Err() error {
+	if !p.State().IsDone() {
+		return nil
+	}
+	return p.err
+}
+
+func (p *FakeProc) Usage() gosh.ResourceUsage {
+	if !p.State().IsDone() {
+		return gosh.ResourceUsage{}
+	}
+	return p.usage
+}
+
+func (p *FakeProc) AddExitListener(callback func(gosh.Proc)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.State().IsDone() {
+		callback(p)
+	} else {
+		p.exitListeners = append(p.exitListeners, callback)
+	}
+}
+
+func (p *FakeProc) Kill() {
+	p.signal(os.Kill, false)
+}
+
+func (p *FakeProc) Signal(sig os.Signal) {
+	p.signal(sig, false)
+}
+
+func (p *FakeProc) SignalGroup(sig os.Signal) {
+	p.signal(sig, true)
+}
+
+func (p *FakeProc) KillGroup() {
+	p.signal(syscall.SIGKILL, true)
+}
+
+//
+// Below lieth Guts
+//
+
+func (p *FakeProc) signal(sig os.Signal, group bool) {
+	p.sigMutex.Lock()
+	p.signals = append(p.signals, sig)
+	p.groupSignals = append(p.groupSignals, group)
+	p.sigMutex.Unlock()
+
+	if p.OnSignal != nil {
+		p.OnSignal(p, sig)
+	}
+}
+
+func (p *FakeProc) transitionFinal(state gosh.State, status gosh.ExitStatus, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.State().IsDone() {
+		return
+	}
+	if !p.State().IsStarted() {
+		p.pid = 0
+		p.usage.Start = time.Now()
+	}
+	p.exitStatus = status
+	p.err = err
+	p.usage.End = time.Now()
+	atomic.StoreInt32(&p.state, int32(state))
+	for _, cb := range p.exitListeners {
+		cb(p)
+	}
+	close(p.exitCh)
+}
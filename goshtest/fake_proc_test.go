@@ -0,0 +1,88 @@
+package goshtest
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/polydawn/gosh"
+)
+
+func TestFakeProc(t *testing.T) {
+	Convey("Given a new FakeProc", t, func() {
+		p := NewFakeProc()
+
+		Convey("It should be unstarted, and not done", func() {
+			So(p.State(), ShouldEqual, gosh.UNSTARTED)
+			So(p.Pid(), ShouldEqual, -1)
+			So(p.GetExitCodeSoon(10*time.Millisecond), ShouldEqual, -1)
+		})
+
+		Convey("Starting it should make it running, with the pid", func() {
+			p.Start(42)
+			So(p.State(), ShouldEqual, gosh.RUNNING)
+			So(p.Pid(), ShouldEqual, 42)
+			So(p.WaitSoon(10*time.Millisecond), ShouldBeFalse)
+		})
+
+		Convey("Exit listeners should see the final state before waits return", func() {
+			p.Start(42)
+			var order []string
+			p.AddExitListener(func(p gosh.Proc) {
+				order = append(order, "listener")
+				So(p.State(), ShouldEqual, gosh.FINISHED)
+				So(p.GetExitCodeSoon(0), ShouldEqual, -1) // waits haven't returned yet
+			})
+			waited := make(chan struct{})
+			go func() {
+				p.Wait()
+				close(waited)
+			}()
+			p.Exit(3)
+			<-waited
+			order = append(order, "wait")
+			So(order, ShouldResemble, []string{"listener", "wait"})
+			So(p.GetExitCode(), ShouldEqual, 3)
+			So(p.Err(), ShouldBeNil)
+
+			Convey("Listeners added afterwards should be called immediately", func() {
+				called := false
+				p.AddExitListener(func(gosh.Proc) { called = true })
+				So(called, ShouldBeTrue)
+			})
+			Convey("Exiting again should change nothing", func() {
+				p.Exit(4)
+				So(p.GetExitCode(), ShouldEqual, 3)
+			})
+		})
+
+		Convey("Panicking it should set the error", func() {
+			p.Start(42)
+			p.Panic(gosh.ProcMonitorError{})
+			So(p.State(), ShouldEqual, gosh.PANICKED)
+			So(p.Err(), ShouldResemble, gosh.ProcMonitorError{})
+			So(p.GetExitCode(), ShouldEqual, -1)
+		})
+
+		Convey("Signals should be recorded", func() {
+			p.Start(42)
+			p.Signal(syscall.SIGTERM)
+			p.KillGroup()
+			So(p.Signals(), ShouldResemble, []os.Signal{syscall.SIGTERM, syscall.SIGKILL})
+			So(p.GroupSignals(), ShouldResemble, []os.Signal{syscall.SIGKILL})
+			So(p.State(), ShouldEqual, gosh.RUNNING)
+
+			Convey("And given OnSignal, it can die of them", func() {
+				p.OnSignal = func(p *FakeProc, sig os.Signal) {
+					p.ExitWith(gosh.ExitStatus{Signal: sig.(syscall.Signal)})
+				}
+				p.Kill()
+				So(p.ExitStatus().Signaled(), ShouldBeTrue)
+				So(p.GetExitCode(), ShouldEqual, 128+9)
+			})
+		})
+	})
+}
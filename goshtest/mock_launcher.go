@@ -0,0 +1,351 @@
+package goshtest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/polydawn/gosh"
+	"github.com/polydawn/gosh/iox"
+)
+
+/*
+	MockLauncher is a `gosh.Launcher` for unit tests: it doesn't run
+	anything, but answers each command with a response scripted by `On`,
+	and keeps track of what it was asked to launch so tests can make
+	assertions about it afterwards.
+
+		m := goshtest.NewMockLauncher()
+		m.On("git", "push", "...").Stderr("rejected\n").ExitCode(1)
+		git := gosh.Gosh("git", gosh.Opts{Launcher: m.Launch})
+		// ... code under test runs `git push origin master` ...
+		m.AssertCalled(t, 1, "git", "push", "...")
+
+	Launching a command that no `On` pattern matches raises an
+	`UnexpectedCommandError`.
+*/
+type MockLauncher struct {
+	mutex    sync.Mutex
+	stubs    []*Stub
+	launches []gosh.Opts
+	nextPid  int
+}
+
+func NewMockLauncher() *MockLauncher {
+	return &MockLauncher{nextPid: 1000}
+}
+
+/*
+	Scripts the response to commands whose args match `pattern`, and
+	returns the `Stub` for filling in the details.  By default, the
+	response is to exit zero without any output.
+
+	Each element of the pattern matches one arg, and may use the `*`
+	wildcard (any run of characters) and `?` (any one character).  A
+	last element of "..." matches any number of remaining args,
+	including none.
+
+	When a command matches several stubs, the one scripted first wins,
+	unless it's used up (see `Stub.Times`).
+*/
+func (m *MockLauncher) On(pattern ...string) *Stub {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s := &Stub{pattern: pattern, status: gosh.ExitStatus{Exited: true}}
+	m.stubs = append(m.stubs, s)
+	return s
+}
+
+/*
+	The `gosh.Launcher`.  Use this as `Opts.Launcher`.
+
+	The returned Proc is a `*FakeProc`, which is already running.
+	The scripted stdout and stderr are written to the command's `Out` and
+	`Err` (except where those are a `gosh.Redirect`; no files are touched),
+	and then it exits with the scripted status.  The command's input isn't
+	read; but if it's another Command, as in a pipeline, that's launched by
+	this launcher too, whatever launcher it was given (with its output
+	discarded), and the returned Proc is a `*gosh.PipelineProc` of the
+	stages, so failures upstream are reported just as they'd be for real.
+*/
+func (m *MockLauncher) Launch(cmdt gosh.Opts) gosh.Proc {
+	if cmdt.Args == nil || len(cmdt.Args) < 1 {
+		panic(gosh.NoArgumentsError{})
+	}
+	var upstream gosh.Proc
+	var upstreamOpts gosh.Opts
+	if in, ok := cmdt.In.(gosh.Command); ok {
+		upstreamOpts = in.Bake(gosh.Opts{Out: ioutil.Discard, Launcher: m.Launch}).Opts()
+		upstream = m.Launch(upstreamOpts)
+	}
+
+	m.mutex.Lock()
+	m.launches = append(m.launches, cmdt)
+	var stub *Stub
+	for _, s := range m.stubs {
+		if (s.limit == 0 || s.calls < s.limit) && matchArgs(s.pattern, cmdt.Args) {
+			stub = s
+			break
+		}
+	}
+	if stub == nil {
+		m.mutex.Unlock()
+		panic(UnexpectedCommandError{Args: cmdt.Args})
+	}
+	stub.calls++
+	pid := m.nextPid
+	m.nextPid++
+	m.mutex.Unlock()
+
+	p := NewFakeProc()
+	p.Start(pid)
+	if stub.fn != nil {
+		stub.fn(cmdt, p)
+	} else {
+		go func() {
+			closeErr := cmdt.CloseErr && !(cmdt.CloseOut && iox.IsChanSink(cmdt.Err) && cmdt.Err == cmdt.Out)
+			writeOutput(cmdt.Out, stub.stdout, cmdt.CloseOut)
+			writeOutput(cmdt.Err, stub.stderr, closeErr)
+			p.ExitWith(stub.status)
+		}()
+	}
+	if upstream != nil {
+		return gosh.JoinPipeline(upstream, upstreamOpts, p, cmdt)
+	}
+	return p
+}
+
+/*
+	Returns the options of every command launched so far, in order.
+*/
+func (m *MockLauncher) Launches() []gosh.Opts {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]gosh.Opts(nil), m.launches...)
+}
+
+/*
+	Returns how many of the commands launched so far have args matching
+	`pattern` (which works as for `On`).
+*/
+func (m *MockLauncher) Calls(pattern ...string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	n := 0
+	for _, cmdt := range m.launches {
+		if matchArgs(pattern, cmdt.Args) {
+			n++
+		}
+	}
+	return n
+}
+
+/*
+	Fails the test unless exactly `times` of the commands launched so far
+	have args matching `pattern`.  Returns whether it passed.
+*/
+func (m *MockLauncher) AssertCalled(t TestingT, times int, pattern ...string) bool {
+	t.Helper()
+	if n := m.Calls(pattern...); n != times {
+		t.Errorf("expected `%s` to be called %s, but it was called %s", strings.Join(pattern, " "), countTimes(times), countTimes(n))
+		return false
+	}
+	return true
+}
+
+/*
+	Fails the test unless every stub has been used: exactly as many times
+	as it was limited to with `Stub.Times`, or at least once if it wasn't.
+	Returns whether it passed.
+*/
+func (m *MockLauncher) AssertExpectations(t TestingT) bool {
+	t.Helper()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ok := true
+	for _, s := range m.stubs {
+		switch {
+		case s.limit > 0 && s.calls != s.limit:
+			t.Errorf("expected `%s` to be called %s, but it was called %s", strings.Join(s.pattern, " "), countTimes(s.limit), countTimes(s.calls))
+			ok = false
+		case s.limit == 0 && s.calls == 0:
+			t.Errorf("expected `%s` to be called, but it wasn't", strings.Join(s.pattern, " "))
+			ok = false
+		}
+	}
+	return ok
+}
+
+/*
+	The bits of `testing.TB` that the assertions need.
+*/
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+/*
+	Stub is a scripted response for a `MockLauncher`, as made by `On`.
+	Its methods fill in the details, and return the stub again so they
+	can be chained.  Set them up before anything is launched.
+*/
+type Stub struct {
+	pattern []string
+	stdout  string
+	stderr  string
+	status  gosh.ExitStatus
+	limit   int // zero for no limit
+	fn      func(gosh.Opts, *FakeProc)
+	calls   int // guarded by the launcher's mutex
+}
+
+/*
+	Sets what the command writes to stdout.
+*/
+func (s *Stub) Stdout(str string) *Stub {
+	s.stdout = str
+	return s
+}
+
+/*
+	Sets what the command writes to stderr.
+*/
+func (s *Stub) Stderr(str string) *Stub {
+	s.stderr = str
+	return s
+}
+
+/*
+	Sets the code the command exits with.
+*/
+func (s *Stub) ExitCode(code int) *Stub {
+	s.status = gosh.ExitStatus{Exited: true, Code: code}
+	return s
+}
+
+/*
+	Makes the command look like it was terminated by `sig`.
+*/
+func (s *Stub) Signal(sig syscall.Signal) *Stub {
+	s.status = gosh.ExitStatus{Signal: sig}
+	return s
+}
+
+/*
+	Limits the stub to answering `n` commands; after that, it no longer
+	matches anything, and later stubs (or an `UnexpectedCommandError`)
+	get their turn.  `AssertExpectations` checks it was used exactly
+	`n` times.
+*/
+func (s *Stub) Times(n int) *Stub {
+	s.limit = n
+	return s
+}
+
+/*
+	Replaces the scripted response with a function, which is called with
+	the command's options and the (running) `FakeProc` to be returned
+	for it.  The function is responsible for finishing the proc, though
+	it needn't do it before returning; it can hand the proc to another
+	goroutine, for example, to test code that waits on it.
+*/
+func (s *Stub) Do(fn func(cmdt gosh.Opts, p *FakeProc)) *Stub {
+	s.fn = fn
+	return s
+}
+
+/*
+	UnexpectedCommandError is raised by a `MockLauncher` when asked to launch
+	a command that none of its stubs match.
+*/
+type UnexpectedCommandError struct {
+	Args []string
+}
+
+func (err UnexpectedCommandError) Error() string {
+	return fmt.Sprintf("goshtest: unexpected command: %q", err.Args)
+}
+func (err UnexpectedCommandError) GoshError() {}
+
+var _ gosh.Error = UnexpectedCommandError{}
+
+//
+// Below lieth Guts
+//
+
+func matchArgs(pattern []string, args []string) bool {
+	if n := len(pattern); n > 0 && pattern[n-1] == "..." {
+		pattern = pattern[:n-1]
+		if len(args) < len(pattern) {
+			return false
+		}
+		args = args[:len(pattern)]
+	}
+	if len(args) != len(pattern) {
+		return false
+	}
+	for i := range pattern {
+		if !matchGlob(pattern[i], args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	Matches `*` and `?` like a shell would, except that they match slashes
+	too (unlike `path.Match`); args aren't necessarily paths.
+*/
+func matchGlob(pattern, s string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == s
+	}
+	var re strings.Builder
+	re.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String()).MatchString(s)
+}
+
+func writeOutput(sink interface{}, str string, close bool) {
+	if sink == nil {
+		return
+	}
+	if _, ok := sink.(gosh.Redirect); ok {
+		return
+	}
+	w := iox.WriterFromInterface(sink)
+	if str != "" {
+		io.WriteString(w, str)
+	}
+	if f, ok := w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if close && iox.IsChanSink(sink) {
+		w.(io.Closer).Close()
+	}
+}
+
+func countTimes(n int) string {
+	switch n {
+	case 1:
+		return "once"
+	case 2:
+		return "twice"
+	default:
+		return fmt.Sprintf("%d times", n)
+	}
+}
@@ -0,0 +1,111 @@
+package goshtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"syscall"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/polydawn/gosh"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMockLauncher(t *testing.T) {
+	Convey("Given a MockLauncher with some stubs", t, func() {
+		m := NewMockLauncher()
+		m.On("git", "status").Stdout("clean\n")
+		m.On("git", "push", "...").Stderr("rejected\n").ExitCode(1).Times(1)
+		m.On("git", "push", "...").Stdout("pushed\n")
+		m.On("kill-me").Signal(syscall.SIGTERM)
+		git := gosh.Gosh("git", gosh.Opts{Launcher: m.Launch})
+
+		Convey("Commands should get their scripted output", func() {
+			So(git.Bake("status").Output(), ShouldEqual, "clean\n")
+		})
+
+		Convey("Limited stubs should give way to later ones once used up", func() {
+			p, err := git.Bake("push", "origin", "master", gosh.Opts{Err: ioutil.Discard}).RunE()
+			So(err, ShouldHaveSameTypeAs, gosh.FailureExitCode{})
+			So(p.GetExitCode(), ShouldEqual, 1)
+			So(git.Bake("push").Output(), ShouldEqual, "pushed\n")
+			So(m.Calls("git", "push", "..."), ShouldEqual, 2)
+			So(m.Calls("git", "push"), ShouldEqual, 1)
+		})
+
+		Convey("Signals should be reported as such", func() {
+			p, _ := gosh.Gosh("kill-me", gosh.Opts{Launcher: m.Launch}).RunE()
+			So(p.ExitStatus().Signal, ShouldEqual, syscall.SIGTERM)
+		})
+
+		Convey("Upstream stages of a pipeline should be mocked too", func() {
+			m.On("gosh-not-installed").Stdout("ignored\n")
+			So(gosh.Pipe(gosh.Gosh("gosh-not-installed"), git.Bake("status")).Output(), ShouldEqual, "clean\n")
+			So(m.Calls("gosh-not-installed"), ShouldEqual, 1)
+		})
+
+		Convey("Failures upstream should fail the pipeline", func() {
+			m.On("gosh-not-installed").ExitCode(2)
+			p, err := gosh.Pipe(gosh.Gosh("gosh-not-installed"), git.Bake("status", gosh.Opts{Out: ioutil.Discard})).RunE()
+			So(err, ShouldHaveSameTypeAs, gosh.FailureExitCode{})
+			So(err.(gosh.FailureExitCode).PipelineStage, ShouldEqual, 1)
+			So(p.GetExitCode(), ShouldEqual, 2)
+			So(p.(*gosh.PipelineProc).FailedStage(), ShouldEqual, 0)
+		})
+
+		Convey("Unmatched commands should raise an error", func() {
+			_, err := git.Bake("rebase").RunE()
+			So(err, ShouldResemble, UnexpectedCommandError{Args: []string{"git", "rebase"}})
+		})
+
+		Convey("Globs should match within args", func() {
+			m.On("ls", "-?", "/tmp/*").Stdout("x\n")
+			ls := gosh.Gosh("ls", gosh.Opts{Launcher: m.Launch})
+			So(ls.Bake("-l", "/tmp/a/b").Output(), ShouldEqual, "x\n")
+			_, err := ls.Bake("-la", "/tmp/a").RunE()
+			So(err, ShouldHaveSameTypeAs, UnexpectedCommandError{})
+		})
+
+		Convey("Assertions should report call counts", func() {
+			git.Bake("status").Output()
+			rt := &recordingT{}
+			So(m.AssertCalled(rt, 1, "git", "status"), ShouldBeTrue)
+			So(m.AssertCalled(rt, 1, "git", "push", "..."), ShouldBeFalse)
+			So(rt.errors, ShouldResemble, []string{
+				"expected `git push ...` to be called once, but it was called 0 times",
+			})
+
+			rt = &recordingT{}
+			So(m.AssertExpectations(rt), ShouldBeFalse)
+			So(rt.errors, ShouldResemble, []string{
+				"expected `git push ...` to be called once, but it was called 0 times",
+				"expected `git push ...` to be called, but it wasn't",
+				"expected `kill-me` to be called, but it wasn't",
+			})
+		})
+
+		Convey("Do should hand over the proc", func() {
+			release := make(chan struct{})
+			m.On("sleep", "...").Do(func(cmdt gosh.Opts, p *FakeProc) {
+				go func() {
+					<-release
+					p.Exit(0)
+				}()
+			})
+			p := gosh.Gosh("sleep", "9", gosh.Opts{Launcher: m.Launch}).Start()
+			So(p.State(), ShouldEqual, gosh.RUNNING)
+			So(p.Pid(), ShouldBeGreaterThan, 0)
+			close(release)
+			So(p.GetExitCode(), ShouldEqual, 0)
+		})
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"syscall"
 )
 
 /*
@@ -32,12 +33,16 @@ var NullIO = Opts{
 
 /*
 	Bake this in to make `Run()` accept any exit code.
+	(Death by any signal is accepted as well.)
 */
-var AnyExit []int = make([]int, 256)
+var AnyExit []int = make([]int, 256, 256+64)
 
 func init() {
 	// This is kinda gross, but 'nil' in `Opts.OkExit` means "don't update", so.
 	for i := 0; i <= 255; i++ {
 		AnyExit[i] = i
 	}
+	for sig := 1; sig <= 64; sig++ {
+		AnyExit = append(AnyExit, SignalExit(syscall.Signal(sig)))
+	}
 }
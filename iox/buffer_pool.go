@@ -0,0 +1,130 @@
+package iox
+
+import (
+	"io"
+	"sync"
+)
+
+/*
+	A pool of same-sized byte slices, for passing data around in chunks
+	without allocating a fresh slice for every chunk.
+*/
+type BufferPool struct {
+	chunkSize int
+	pool      sync.Pool
+}
+
+func NewBufferPool(chunkSize int) *BufferPool {
+	if chunkSize <= 0 {
+		panic(BufferPoolChunkSizeError{chunkSize})
+	}
+	bp := &BufferPool{chunkSize: chunkSize}
+	bp.pool.New = func() interface{} {
+		buf := make([]byte, chunkSize)
+		return &buf
+	}
+	return bp
+}
+
+/*
+	The length of the slices handed out by `Get`, and so the largest chunk
+	anything using the pool will produce.
+*/
+func (bp *BufferPool) ChunkSize() int {
+	return bp.chunkSize
+}
+
+/*
+	Returns a slice of length `ChunkSize()`, either recycled or newly allocated.
+*/
+func (bp *BufferPool) Get() []byte {
+	return (*bp.pool.Get().(*[]byte))[:bp.chunkSize]
+}
+
+/*
+	Gives a slice back to the pool to be reused.  The slice must not be used
+	again by the caller afterwards.  Slices too small to have come from this
+	pool are ignored.
+*/
+func (bp *BufferPool) Put(buf []byte) {
+	if cap(buf) < bp.chunkSize {
+		return
+	}
+	buf = buf[:bp.chunkSize]
+	bp.pool.Put(&buf)
+}
+
+/*
+	Like `WriterToChanByteSlice`, but the slices sent are taken from `pool`,
+	and are never larger than the pool's chunk size (bigger writes are split).
+
+	Receivers own the slices they get just the same, and can simply let
+	them be garbage collected; but a receiver that's done with a slice can
+	instead hand it back with `pool.Put`, so its memory gets reused for
+	later chunks rather than allocated afresh.  (Only the chunks' memory,
+	that is: the pool still makes a small allocation to keep track of
+	each slice it's given back.)
+
+	The returned writer is also an `io.ReaderFrom`, so `io.Copy` into it
+	(which is what `os/exec` does with a command's output) reads straight
+	into the pooled slices, with no copying in between.
+*/
+func WriterToChanByteSlicePooled(ch chan<- []byte, pool *BufferPool) io.WriteCloser {
+	return &writerChanByteSlicePooled{ch: ch, pool: pool}
+}
+
+type writerChanByteSlicePooled struct {
+	ch   chan<- []byte
+	pool *BufferPool
+}
+
+func (w *writerChanByteSlicePooled) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		buf := w.pool.Get()
+		m := copy(buf, p)
+		if !w.send(buf[:m]) {
+			w.pool.Put(buf)
+			return n, io.EOF
+		}
+		n += m
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (w *writerChanByteSlicePooled) ReadFrom(r io.Reader) (n int64, err error) {
+	for {
+		buf := w.pool.Get()
+		m, err := r.Read(buf)
+		if m > 0 {
+			if !w.send(buf[:m]) {
+				w.pool.Put(buf)
+				return n, io.EOF
+			}
+			n += int64(m)
+		} else {
+			w.pool.Put(buf)
+		}
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+func (w *writerChanByteSlicePooled) Close() error {
+	defer func() { recover() }() // already closed is fine
+	close(w.ch)
+	return nil
+}
+
+func (w *writerChanByteSlicePooled) send(buf []byte) (ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			ok = false
+		}
+	}()
+	w.ch <- buf
+	return true
+}
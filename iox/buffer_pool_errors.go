@@ -0,0 +1,16 @@
+package iox
+
+import (
+	. "fmt"
+)
+
+/*
+	Error raised by NewBufferPool() when asked for chunks of a size that isn't positive.
+*/
+type BufferPoolChunkSizeError struct {
+	Size int
+}
+
+func (err BufferPoolChunkSizeError) Error() string {
+	return Sprintf("buffer pool chunk size must be positive, not %d", err.Size)
+}
@@ -0,0 +1,109 @@
+package iox
+
+import (
+	"fmt"
+	"sync"
+)
+
+/*
+	A buffer that keeps only the first `head` and the last `tail` bytes
+	written to it, and counts how much was dropped in between; for keeping
+	hold of output that might be enormous, in bounded memory.
+
+	It's safe for concurrent use (so the same one can be used for a
+	command's stdout and stderr).
+*/
+type HeadTailBuffer struct {
+	mutex   sync.Mutex
+	head    []byte
+	headCap int
+	ring    []byte // len is the tail size; holds `ringLen` bytes ending just before `pos`
+	ringLen int
+	pos     int
+	total   int64
+}
+
+func NewHeadTailBuffer(head, tail int) *HeadTailBuffer {
+	if head < 0 || tail < 0 {
+		panic(HeadTailSizeError{head, tail})
+	}
+	return &HeadTailBuffer{
+		headCap: head,
+		ring:    make([]byte, tail),
+	}
+}
+
+func (b *HeadTailBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	n := len(p)
+	b.total += int64(n)
+	if room := b.headCap - len(b.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.head = append(b.head, p[:room]...)
+		p = p[room:]
+	}
+	tailCap := len(b.ring)
+	if tailCap == 0 || len(p) == 0 {
+		return n, nil
+	}
+	if len(p) >= tailCap {
+		copy(b.ring, p[len(p)-tailCap:])
+		b.pos, b.ringLen = 0, tailCap
+		return n, nil
+	}
+	k := copy(b.ring[b.pos:], p)
+	copy(b.ring, p[k:])
+	b.pos = (b.pos + len(p)) % tailCap
+	b.ringLen += len(p)
+	if b.ringLen > tailCap {
+		b.ringLen = tailCap
+	}
+	return n, nil
+}
+
+/*
+	The total number of bytes written, including any that weren't kept.
+*/
+func (b *HeadTailBuffer) Total() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.total
+}
+
+/*
+	The number of bytes written that weren't kept.
+*/
+func (b *HeadTailBuffer) Elided() int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.elided()
+}
+
+func (b *HeadTailBuffer) elided() int64 {
+	return b.total - int64(len(b.head)) - int64(b.ringLen)
+}
+
+/*
+	Returns the head and the tail, with a marker like
+	"\n...1234 bytes elided...\n" between them if anything was dropped.
+	If nothing was, that's simply everything that was written.
+*/
+func (b *HeadTailBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	s := string(b.head)
+	if elided := b.elided(); elided > 0 {
+		s += fmt.Sprintf("\n...%d bytes elided...\n", elided)
+	}
+	if b.ringLen < len(b.ring) {
+		s += string(b.ring[b.pos-b.ringLen : b.pos])
+	} else {
+		s += string(b.ring[b.pos:]) + string(b.ring[:b.pos])
+	}
+	return s
+}
@@ -0,0 +1,17 @@
+package iox
+
+import (
+	. "fmt"
+)
+
+/*
+	Error raised by NewHeadTailBuffer() when asked for a negative head or tail size.
+*/
+type HeadTailSizeError struct {
+	Head int
+	Tail int
+}
+
+func (err HeadTailSizeError) Error() string {
+	return Sprintf("head and tail sizes must not be negative, not %d and %d", err.Head, err.Tail)
+}
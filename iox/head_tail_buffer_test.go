@@ -0,0 +1,52 @@
+package iox
+
+import (
+	"github.com/coocood/assrt"
+	"strings"
+	"testing"
+)
+
+func TestHeadTailBuffer(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	b := NewHeadTailBuffer(4, 6)
+	b.Write([]byte("ab"))
+	assert.Equal("ab", b.String())
+	b.Write([]byte("cdefgh"))
+	assert.Equal("abcdefgh", b.String())
+	b.Write([]byte("ijk"))
+	assert.Equal("abcd\n...1 bytes elided...\nfghijk", b.String())
+	b.Write([]byte("l"))
+	b.Write([]byte("mnop"))
+	assert.Equal("abcd\n...6 bytes elided...\nklmnop", b.String())
+	b.Write([]byte(strings.Repeat("x", 100) + "qrstuv"))
+	assert.Equal("abcd\n...112 bytes elided...\nqrstuv", b.String())
+	assert.Equal(int64(122), b.Total())
+	assert.Equal(int64(112), b.Elided())
+}
+
+func TestHeadTailBufferHeadOnly(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	b := NewHeadTailBuffer(3, 0)
+	b.Write([]byte("abcdef"))
+	assert.Equal("abc\n...3 bytes elided...\n", b.String())
+}
+
+func TestHeadTailBufferTailOnly(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	b := NewHeadTailBuffer(0, 3)
+	b.Write([]byte("abcdef"))
+	b.Write([]byte("g"))
+	assert.Equal("\n...4 bytes elided...\nefg", b.String())
+}
+
+func TestHeadTailBufferNegativeSize(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	defer func() {
+		assert.Equal(HeadTailSizeError{-1, 3}, recover())
+	}()
+	NewHeadTailBuffer(-1, 3)
+}
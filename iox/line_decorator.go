@@ -0,0 +1,169 @@
+package iox
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+	Returns a writer that passes everything through to `w`, with the string
+	returned by `prefix` put at the start of every line.  `prefix` is called
+	as each line is completed, so it can e.g. return a timestamp.
+
+	Only whole lines are written to `w`, each in a single `Write` call, and
+	decorators sharing the same `w` take turns: so many processes' output
+	can be decorated onto e.g. `os.Stdout` without lines getting mixed up.
+
+	Partial lines are held until the rest arrives, or until `Flush` or `Close`
+	(which end the partial line with a line break).  Call `Close` when done
+	with the decorator; it does not close `w`.
+*/
+func DecorateLines(w io.Writer, prefix func() string) *LineDecorator {
+	return &LineDecorator{
+		w:      w,
+		prefix: prefix,
+		lock:   acquireDestLock(w),
+	}
+}
+
+/*
+	Returns a writer that prefixes every line with `prefix`.  See `DecorateLines`.
+*/
+func PrefixLines(w io.Writer, prefix string) *LineDecorator {
+	return DecorateLines(w, func() string { return prefix })
+}
+
+/*
+	Returns a writer that prefixes every line with the time it was written,
+	formatted according to `layout` (as by `time.Time.Format`), and a space.
+	See `DecorateLines`.
+*/
+func TimestampLines(w io.Writer, layout string) *LineDecorator {
+	return DecorateLines(w, func() string { return time.Now().Format(layout) + " " })
+}
+
+/*
+	An io.WriteCloser that decorates lines; see `DecorateLines`.
+*/
+type LineDecorator struct {
+	mutex  sync.Mutex
+	w      io.Writer
+	prefix func() string
+	lock   *destLock
+	buf    []byte
+}
+
+func (d *LineDecorator) Write(p []byte) (int, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.buf = append(d.buf, p...)
+	var out []byte
+	for {
+		i := bytes.IndexByte(d.buf, '\n')
+		if i < 0 {
+			break
+		}
+		out = append(out, d.prefix()...)
+		out = append(out, d.buf[:i+1]...)
+		d.buf = d.buf[i+1:]
+	}
+	if len(d.buf) == 0 {
+		d.buf = nil
+	}
+	if err := d.emit(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+/*
+	Writes out any partial line, ending it with a line break.
+*/
+func (d *LineDecorator) Flush() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.buf) == 0 {
+		return nil
+	}
+	out := append([]byte(d.prefix()), d.buf...)
+	out = append(out, '\n')
+	d.buf = nil
+	return d.emit(out)
+}
+
+/*
+	Flushes, and releases the decorator's claim on the shared destination.
+	Does not close the destination writer.
+*/
+func (d *LineDecorator) Close() error {
+	err := d.Flush()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.lock != nil {
+		releaseDestLock(d.w, d.lock)
+		d.lock = nil
+	}
+	return err
+}
+
+func (d *LineDecorator) emit(out []byte) error {
+	if len(out) == 0 {
+		return nil
+	}
+	lock := d.lock
+	if lock == nil { // closed; we're on our own
+		_, err := d.w.Write(out)
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	_, err := d.w.Write(out)
+	return err
+}
+
+/*
+	Locks shared by all the decorators writing to the same destination.
+	They're counted, so the table doesn't keep destinations alive forever.
+*/
+var destLocks = struct {
+	sync.Mutex
+	m map[io.Writer]*destLock
+}{m: map[io.Writer]*destLock{}}
+
+type destLock struct {
+	sync.Mutex
+	refs int
+}
+
+func acquireDestLock(w io.Writer) *destLock {
+	if !reflect.TypeOf(w).Comparable() {
+		// can't be looked up, so can't be shared; a lock of its own will do.
+		return &destLock{}
+	}
+	destLocks.Lock()
+	defer destLocks.Unlock()
+	l, ok := destLocks.m[w]
+	if !ok {
+		l = &destLock{}
+		destLocks.m[w] = l
+	}
+	l.refs++
+	return l
+}
+
+func releaseDestLock(w io.Writer, l *destLock) {
+	if !reflect.TypeOf(w).Comparable() {
+		return
+	}
+	destLocks.Lock()
+	defer destLocks.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(destLocks.m, w)
+	}
+}
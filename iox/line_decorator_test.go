@@ -0,0 +1,64 @@
+package iox
+
+import (
+	"bytes"
+	"github.com/coocood/assrt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrefixLines(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	var buf bytes.Buffer
+	w := PrefixLines(&buf, "a| ")
+	w.Write([]byte("one\ntw"))
+	assert.Equal("a| one\n", buf.String())
+	w.Write([]byte("o\nthr"))
+	assert.Equal("a| one\na| two\n", buf.String())
+	w.Close()
+	assert.Equal("a| one\na| two\na| thr\n", buf.String())
+	assert.Equal(0, len(destLocks.m))
+}
+
+func TestDecoratedLinesAreAtomic(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	var buf bytes.Buffer
+	var wg sync.WaitGroup
+	for _, label := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(label string) {
+			defer wg.Done()
+			w := PrefixLines(&buf, label+"| ")
+			defer w.Close()
+			for i := 0; i < 100; i++ {
+				// write each line in dribs and drabs
+				w.Write([]byte(label))
+				w.Write([]byte(label + "\n"))
+			}
+		}(label)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Equal(300, len(lines))
+	for _, line := range lines {
+		label := line[:1]
+		assert.Equal(label+"| "+label+label, line)
+	}
+}
+
+func TestTimestampLines(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	var buf bytes.Buffer
+	inner := PrefixLines(&buf, "a| ")
+	defer inner.Close()
+	w := TimestampLines(inner, "2006")
+	defer w.Close()
+	w.Write([]byte("one\n"))
+	assert.Equal(true, strings.HasPrefix(buf.String(), "a| 2"))
+	assert.Equal(true, strings.HasSuffix(buf.String(), " one\n"))
+}
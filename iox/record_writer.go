@@ -0,0 +1,113 @@
+package iox
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+/*
+	Returns a writer that sends whole lines to the channel: partial lines
+	are buffered until the rest of the line arrives, and several lines in
+	one write are sent separately.
+
+	If `keepNewline` is set, each line is sent with its trailing "\n";
+	otherwise it's stripped.
+
+	Whatever is left over after the last line break is sent by `Flush` or
+	`Close`.
+*/
+func WriterToChanLines(ch chan<- string, keepNewline bool) *RecordWriter {
+	return WriterToChanRecords(ch, '\n', keepNewline)
+}
+
+/*
+	Like `WriterToChanLines`, but splits on any delimiter byte.
+	For example, `WriterToChanRecords(ch, 0, false)` reads the output of
+	`find -print0` one filename at a time.
+*/
+func WriterToChanRecords(ch chan<- string, delim byte, keepDelim bool) *RecordWriter {
+	return &RecordWriter{ch: ch, delim: delim, keepDelim: keepDelim}
+}
+
+/*
+	An io.WriteCloser that sends delimited records to a channel.
+	See `WriterToChanLines` and `WriterToChanRecords`.
+
+	Like the other channel writers, writes after the channel has been
+	closed (by someone else) return `io.EOF`.
+*/
+type RecordWriter struct {
+	mutex     sync.Mutex
+	ch        chan<- string
+	delim     byte
+	keepDelim bool
+	buf       []byte
+}
+
+func (w *RecordWriter) Write(p []byte) (n int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, w.delim)
+		if i < 0 {
+			break
+		}
+		rec := w.buf[:i]
+		if w.keepDelim {
+			rec = w.buf[:i+1]
+		}
+		if !w.send(string(rec)) {
+			w.buf = nil
+			return 0, io.EOF
+		}
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) == 0 {
+		w.buf = nil // don't hang on to the array forever
+	}
+	return len(p), nil
+}
+
+/*
+	Sends any partial record that's been buffered, as if it had been
+	terminated.  Does nothing if there is none.
+*/
+func (w *RecordWriter) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	rec := string(w.buf)
+	w.buf = nil
+	if !w.send(rec) {
+		return io.EOF
+	}
+	return nil
+}
+
+/*
+	Flushes, then closes the channel.
+*/
+func (w *RecordWriter) Close() error {
+	err := w.Flush()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	defer func() { recover() }() // already closed is fine
+	close(w.ch)
+	return err
+}
+
+func (w *RecordWriter) send(rec string) (ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			ok = false
+		}
+	}()
+	w.ch <- rec
+	return true
+}
@@ -0,0 +1,196 @@
+package iox
+
+import (
+	"io"
+	"sync"
+)
+
+/*
+	Returns a writer that writes everything to all of `sinks`.  The sinks can be
+	anything `WriterFromInterface` understands (and `WriterFromInterface` turns a
+	`[]interface{}` of sinks into a Tee, too).
+
+	Channel sinks are written to asynchronously, so that a slow consumer on a
+	channel doesn't hold up the other sinks: data for it is queued (in memory,
+	without limit) until it's received.  Wrap a channel with `Blocking` to have
+	it written to synchronously instead.  `Flush` waits until all queued data
+	has been delivered.
+
+	If writing to a sink fails (e.g. a channel has been closed), that sink is
+	dropped and the others carry on; writes only fail once every sink has.
+
+	`Close` flushes, and then closes the channel sinks (only: other sinks,
+	like files, are left alone).
+*/
+func Tee(sinks ...interface{}) *TeeWriter {
+	t := &TeeWriter{}
+	for _, sink := range sinks {
+		if b, ok := sink.(blockingSink); ok {
+			w := WriterFromInterface(b.sink)
+			t.writers = append(t.writers, w)
+			if IsChanSink(b.sink) {
+				t.closers = append(t.closers, w.(io.Closer))
+			}
+		} else if IsChanSink(sink) {
+			w := WriterFromInterface(sink)
+			t.writers = append(t.writers, newAsyncWriter(w))
+			t.closers = append(t.closers, w.(io.Closer))
+		} else {
+			t.writers = append(t.writers, WriterFromInterface(sink))
+		}
+	}
+	return t
+}
+
+/*
+	Marks a sink given to `Tee` as one to be written to synchronously, even if
+	it's a channel.  Elsewhere, it's the same as the sink itself.
+*/
+func Blocking(sink interface{}) interface{} {
+	return blockingSink{sink}
+}
+
+type blockingSink struct {
+	sink interface{}
+}
+
+/*
+	An io.Writer that fans out to several others; see `Tee`.
+*/
+type TeeWriter struct {
+	mutex   sync.Mutex
+	writers []io.Writer
+	closers []io.Closer // the writers for channel sinks, which `Close` closes
+}
+
+func (t *TeeWriter) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.writers) == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	live := t.writers[:0]
+	var err error
+	for _, w := range t.writers {
+		if _, err = w.Write(p); err == nil {
+			live = append(live, w)
+		}
+	}
+	t.writers = live
+	if len(live) == 0 {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+/*
+	Waits for any data queued for channel sinks to be delivered, then flushes
+	any sinks that buffer (like the line-framing writers used for `chan string`).
+*/
+func (t *TeeWriter) Flush() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var err error
+	for _, w := range t.writers {
+		if f, ok := w.(flusher); ok {
+			if err2 := f.Flush(); err == nil {
+				err = err2
+			}
+		}
+	}
+	return err
+}
+
+/*
+	Flushes, and then closes every channel sink.  Closing again does nothing.
+*/
+func (t *TeeWriter) Close() error {
+	err := t.Flush()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, c := range t.closers {
+		c.Close()
+	}
+	t.closers = nil
+	t.writers = nil
+	return err
+}
+
+type flusher interface {
+	Flush() error
+}
+
+/*
+	Hands writes off to a goroutine, so the writer never blocks.
+*/
+type asyncWriter struct {
+	w       io.Writer
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	queue   [][]byte
+	running bool
+	err     error
+}
+
+func newAsyncWriter(w io.Writer) *asyncWriter {
+	aw := &asyncWriter{w: w}
+	aw.cond = sync.NewCond(&aw.mutex)
+	return aw
+}
+
+func (aw *asyncWriter) Write(p []byte) (int, error) {
+	aw.mutex.Lock()
+	defer aw.mutex.Unlock()
+
+	if aw.err != nil {
+		return 0, aw.err
+	}
+	aw.queue = append(aw.queue, append([]byte(nil), p...))
+	if !aw.running {
+		aw.running = true
+		go aw.drain()
+	}
+	return len(p), nil
+}
+
+func (aw *asyncWriter) drain() {
+	for {
+		aw.mutex.Lock()
+		if len(aw.queue) == 0 || aw.err != nil {
+			aw.queue = nil
+			aw.running = false
+			aw.cond.Broadcast()
+			aw.mutex.Unlock()
+			return
+		}
+		chunk := aw.queue[0]
+		aw.queue = aw.queue[1:]
+		aw.mutex.Unlock()
+
+		if _, err := aw.w.Write(chunk); err != nil {
+			aw.mutex.Lock()
+			aw.err = err
+			aw.mutex.Unlock()
+		}
+	}
+}
+
+func (aw *asyncWriter) Flush() error {
+	aw.mutex.Lock()
+	for aw.running {
+		aw.cond.Wait()
+	}
+	err := aw.err
+	aw.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if f, ok := aw.w.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
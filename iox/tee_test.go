@@ -0,0 +1,97 @@
+package iox
+
+import (
+	"bytes"
+	"github.com/coocood/assrt"
+	"testing"
+	"time"
+)
+
+func TestTee(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	var buf1, buf2 bytes.Buffer
+	ch := make(chan string, 10)
+	w := WriterFromInterface([]interface{}{&buf1, &buf2, ch}).(*TeeWriter)
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\n"))
+	assert.Equal(nil, w.Flush())
+
+	assert.Equal("one\ntwo\n", buf1.String())
+	assert.Equal("one\ntwo\n", buf2.String())
+	assert.Equal("one\n", <-ch)
+	assert.Equal("two\n", <-ch)
+}
+
+func TestTeeClose(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	var buf bytes.Buffer
+	ch := make(chan string, 10)
+	w := Tee(&buf, ch)
+	w.Write([]byte("one\ntw"))
+	assert.Equal(nil, w.Close())
+
+	assert.Equal("one\ntw", buf.String())
+	var got []string
+	for line := range ch {
+		got = append(got, line)
+	}
+	assert.Equal([]string{"one\n", "tw"}, got)
+	assert.Equal(nil, w.Close())
+}
+
+func TestTeeSlowChannel(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	var buf bytes.Buffer
+	ch := make(chan []byte) // nobody's receiving yet
+	w := Tee(ch, &buf)
+	done := make(chan struct{})
+	go func() {
+		w.Write([]byte("asdf"))
+		w.Write([]byte("qwer"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("tee blocked on a slow channel")
+	}
+	assert.Equal("asdfqwer", buf.String())
+	assert.Equal([]byte("asdf"), <-ch)
+	assert.Equal([]byte("qwer"), <-ch)
+	assert.Equal(nil, w.Flush())
+}
+
+func TestTeeBlockingChannel(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	ch := make(chan []byte)
+	w := Tee(Blocking(ch))
+	done := make(chan struct{})
+	go func() {
+		w.Write([]byte("asdf"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("tee didn't block on a blocking channel")
+	case <-time.After(10 * time.Millisecond):
+	}
+	assert.Equal([]byte("asdf"), <-ch)
+	<-done
+}
+
+func TestTeeDropsFailedSinks(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	var buf bytes.Buffer
+	ch := make(chan string)
+	close(ch)
+	w := Tee(Blocking(ch), &buf)
+	n, err := w.Write([]byte("asdf\n"))
+	assert.Equal(5, n)
+	assert.Equal(nil, err)
+	assert.Equal("asdf\n", buf.String())
+}
@@ -12,12 +12,25 @@ import (
 	Writers will be produced from:
 		io.Writer
 		bytes.Buffer
+		[]interface{} (of any of these; see `Tee`)
 	WriteClosers will be produced from:
-		<-chan string
+		chan<- string
 		chan string
-		<-chan []byte
+		chan<- []byte
 		chan []byte
 
+	Channels of strings are sent whole lines (newline included), as by
+	`WriterToChanLines`; remember to `Flush` or `Close` the writer to
+	send any final unterminated line.
+
+	Channels of byte slices are sent a fresh copy of each write, as by
+	`WriterToChanByteSlice`, rather than pooled chunks: a pooled chunk is
+	always the pool's full chunk size, however little of it is used, so
+	a receiver that keeps small writes around (and doesn't know to give
+	them back) would hold on to far more memory than it was sent.  Use
+	`WriterToChanByteSlicePooled` explicitly where the receivers are
+	written to suit.
+
 	An error of type WriterUnrefinableFromInterface is thrown if an argument
 	of any other type is given.
 */
@@ -28,18 +41,35 @@ func WriterFromInterface(x interface{}) io.Writer {
 	case bytes.Buffer:
 		return &y
 	case chan<- string:
-		return WriterToChanString(y)
+		return WriterToChanLines(y, true)
 	case chan string:
-		return WriterToChanString(y)
+		return WriterToChanLines(y, true)
 	case chan<- []byte:
 		return WriterToChanByteSlice(y)
 	case chan []byte:
 		return WriterToChanByteSlice(y)
+	case []interface{}:
+		return Tee(y...)
+	case blockingSink:
+		return WriterFromInterface(y.sink)
 	default:
 		panic(WriterUnrefinableFromInterface{wat: y})
 	}
 }
 
+/*
+	Reports whether `x` is one of the channel types that `WriterFromInterface`
+	turns into a WriteCloser, whose `Close` closes the channel.
+*/
+func IsChanSink(x interface{}) bool {
+	switch x.(type) {
+	case chan<- string, chan string, chan<- []byte, chan []byte:
+		return true
+	default:
+		return false
+	}
+}
+
 func WriterToChanString(ch chan<- string) io.Writer {
 	return &writerChanString{ch: ch}
 }
@@ -65,6 +95,12 @@ func (r *writerChanString) Close() error {
 	return nil
 }
 
+/*
+	Returns a writer that sends each write to the channel as a new slice.
+	The receiver owns each slice it gets, and may keep or modify it freely.
+
+	See `WriterToChanByteSlicePooled` if the allocations are a burden.
+*/
 func WriterToChanByteSlice(ch chan<- []byte) io.Writer {
 	return &writerChanByteSlice{ch: ch}
 }
@@ -81,11 +117,13 @@ func (r *writerChanByteSlice) Write(p []byte) (n int, err error) {
 		}
 	}()
 
-	r.ch <- p
+	// the caller is free to reuse `p` as soon as we return, so it can't be what we send.
+	r.ch <- append(make([]byte, 0, len(p)), p...)
 	return len(p), nil
 }
 
 func (r *writerChanByteSlice) Close() error {
+	defer func() { recover() }() // already closed is fine
 	close(r.ch)
 	return nil
 }
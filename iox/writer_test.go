@@ -3,6 +3,7 @@ package iox
 import (
 	"github.com/coocood/assrt"
 	"io"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -94,3 +95,120 @@ func TestWriterUnrefinable(t *testing.T) {
 	}()
 	WriterFromInterface(x)
 }
+
+func TestWriterToChanLines(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	ch := make(chan string, 10)
+	w := WriterToChanLines(ch, true)
+	w.Write([]byte("as"))
+	w.Write([]byte("df\nwaka"))
+	w.Write([]byte("waka\n\nz1\nz2"))
+	assert.Equal(nil, w.Close())
+
+	assert.Equal("asdf\n", <-ch)
+	assert.Equal("wakawaka\n", <-ch)
+	assert.Equal("\n", <-ch)
+	assert.Equal("z1\n", <-ch)
+	assert.Equal("z2", <-ch)
+	_, open := <-ch
+	assert.Equal(false, open)
+}
+
+func TestWriterToChanLinesStripped(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	ch := make(chan string, 10)
+	w := WriterToChanLines(ch, false)
+	w.Write([]byte("asdf\nwaka"))
+	assert.Equal(nil, w.Flush())
+	assert.Equal(nil, w.Flush())
+	w.Write([]byte("\n"))
+
+	assert.Equal("asdf", <-ch)
+	assert.Equal("waka", <-ch)
+	assert.Equal("", <-ch)
+	assert.Equal(0, len(ch))
+}
+
+func TestWriterToChanRecords(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	ch := make(chan string, 10)
+	w := WriterToChanRecords(ch, 0, false)
+	w.Write([]byte("a b\x00c\nd\x00"))
+	w.Close()
+
+	assert.Equal("a b", <-ch)
+	assert.Equal("c\nd", <-ch)
+	_, open := <-ch
+	assert.Equal(false, open)
+}
+
+func TestWriterToChanLinesClosed(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	ch := make(chan string, 10)
+	w := WriterToChanLines(ch, true)
+	close(ch)
+	n, err := w.Write([]byte("asdf\n"))
+	assert.Equal(0, n)
+	assert.Equal(io.EOF, err)
+	w.Write([]byte("partial"))
+	assert.Equal(io.EOF, w.Flush())
+}
+
+func TestWriterToChanByteSliceCopies(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	ch := make(chan []byte, 2)
+	w := WriterToChanByteSlice(ch)
+	buf := []byte("asdf")
+	w.Write(buf)
+	copy(buf, "zzzz")
+	w.Write(buf)
+
+	assert.Equal([]byte("asdf"), <-ch)
+	assert.Equal([]byte("zzzz"), <-ch)
+}
+
+func TestWriterToChanByteSlicePooled(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	pool := NewBufferPool(4)
+	ch := make(chan []byte, 10)
+	w := WriterToChanByteSlicePooled(ch, pool)
+	buf := []byte("asdfghjkl")
+	n, err := w.Write(buf)
+	assert.Equal(9, n)
+	assert.Equal(nil, err)
+	copy(buf, "zzzzzzzzz")
+
+	assert.Equal([]byte("asdf"), <-ch)
+	assert.Equal([]byte("ghjk"), <-ch)
+	last := <-ch
+	assert.Equal([]byte("l"), last)
+	pool.Put(last)
+
+	n64, err := io.Copy(w, strings.NewReader("qwertyu"))
+	assert.Equal(int64(7), n64)
+	assert.Equal(nil, err)
+	w.Close()
+	assert.Equal(nil, w.Close()) // twice is fine
+	var got []byte
+	for chunk := range ch {
+		assert.Equal(true, len(chunk) <= 4)
+		got = append(got, chunk...)
+		pool.Put(chunk)
+	}
+	assert.Equal("qwertyu", string(got))
+}
+
+func TestBufferPoolChunkSize(t *testing.T) {
+	assert := assrt.NewAssert(t)
+
+	defer func() {
+		assert.Equal(BufferPoolChunkSizeError{0}, recover())
+	}()
+	NewBufferPool(0)
+}
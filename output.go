@@ -0,0 +1,139 @@
+package gosh
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+/*
+	How much output an `OutputDecodeError` quotes.
+*/
+const decodeSnippetLen = 80
+
+/*
+	Runs the command like `Output()`, and unmarshals its output as JSON into `v`
+	(as by `json.Unmarshal`).
+
+	If the output isn't valid JSON for `v`, an `OutputDecodeError` is raised.
+*/
+func (c Command) OutputJSON(v interface{}) {
+	out := []byte(c.Output())
+	if err := json.Unmarshal(out, v); err != nil {
+		offset := 0
+		switch err2 := err.(type) {
+		case *json.SyntaxError:
+			offset = int(err2.Offset)
+		case *json.UnmarshalTypeError:
+			offset = int(err2.Offset)
+		}
+		panic(OutputDecodeError{
+			Cmdname: c.expose().Args[0],
+			Format:  "JSON",
+			Cause:   err,
+			Snippet: snippetAround(out, offset),
+		})
+	}
+}
+
+/*
+	Runs the command like `Output()`, and returns its output split into lines.
+	The line breaks are not included, and a final line break doesn't result
+	in an empty last line; a command with no output has no lines.
+*/
+func (c Command) OutputLines() []string {
+	out := c.Output()
+	if out == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+}
+
+/*
+	Runs the command like `Output()`, and returns its output as a table:
+	each line split into fields on whitespace, as by `strings.Fields`.
+	Blank lines are skipped.
+*/
+func (c Command) OutputFields() [][]string {
+	var table [][]string
+	for _, line := range c.OutputLines() {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			table = append(table, fields)
+		}
+	}
+	return table
+}
+
+/*
+	Runs the command, decoding its output as a stream of JSON values (as
+	e.g. "NDJSON" tools emit), and calls `fn` with each one as soon as
+	it arrives.
+
+	If the output isn't valid JSON, an `OutputDecodeError` is raised (once
+	the command has exited; it'll no longer be able to write anything);
+	otherwise, as with `Run()`, a panic will be emitted if the command does
+	not execute successfully.
+*/
+func (c Command) OutputJSONStream(fn func(json.RawMessage)) Proc {
+	pr, pw := io.Pipe()
+	cmdt := c.expose()
+	cmdt.Out = pw
+	p := cmdt.start()
+	go func() {
+		p.Wait()
+		pw.Close()
+	}()
+
+	dec := json.NewDecoder(pr)
+	for {
+		var msg json.RawMessage
+		err := dec.Decode(&msg)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			pr.CloseWithError(err)
+			p.Wait()
+			var buf bytes.Buffer
+			io.CopyN(&buf, dec.Buffered(), decodeSnippetLen)
+			panic(OutputDecodeError{
+				Cmdname: cmdt.Args[0],
+				Format:  "JSON",
+				Cause:   err,
+				Snippet: buf.String(),
+			})
+		}
+		func() {
+			// if fn blows up, don't leave the command blocked writing to us.
+			defer func() {
+				if rec := recover(); rec != nil {
+					pr.CloseWithError(io.ErrClosedPipe)
+					panic(rec)
+				}
+			}()
+			fn(msg)
+		}()
+	}
+	if err := cmdt.wait(p); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+/*
+	Returns a bit of `out` from around `offset`, for error messages.
+*/
+func snippetAround(out []byte, offset int) string {
+	start := offset - decodeSnippetLen/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + decodeSnippetLen
+	if end > len(out) {
+		end = len(out)
+	}
+	if start > end {
+		start = end
+	}
+	return string(out[start:end])
+}
@@ -0,0 +1,329 @@
+package gosh
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ Proc = &PipelineProc{}
+
+/*
+	`gosh.Proc` implementation that stands for a whole pipeline of other procs,
+	like `a | b | c` in a shell.
+
+	A PipelineProc is what's returned when launching a Command made by `Pipe`,
+	or more generally any Command with another Command as its `Opts.In`.
+
+	The pipeline is finished when all of its stages are finished.
+	If any stage panicked, the pipeline is PANICKED; otherwise if any stage
+	was cancelled, the pipeline is CANCELLED.
+	The exit code of the pipeline is reported like bash with "pipefail" set:
+	it is the code of the rightmost stage that exited with a status its
+	`Opts.OkExit` didn't permit, or if all stages succeeded, the code of the
+	last stage.
+*/
+type PipelineProc struct {
+	/*
+		Guards all major transitions... *including* to `state`.
+		(Same rules as in `ExecProc`.)
+	*/
+	mutex sync.Mutex
+
+	/* Always access this with functions from the atomic package. */
+	state int32
+
+	/* The procs in the pipeline, in order from first (leftmost) to last. */
+	stages []pipelineStage
+
+	/* Wait for this to close in order to wait for the whole pipeline to return. */
+	exitCh chan struct{}
+
+	/* Functions to call back when the pipeline has exited. */
+	exitListeners []func(Proc)
+}
+
+type pipelineStage struct {
+	proc   Proc
+	name   string
+	okExit []int
+}
+
+/*
+	Assembles a PipelineProc from an upstream proc (which may itself already
+	be a pipeline) and the proc it's feeding, each launched from the given
+	template.  The templates' args name the stages, and their `OkExit`
+	decides which stage failed.
+
+	Launchers do this when the command's `Opts.In` is another Command; it's
+	exported for those outside of gosh, so their pipelines behave just
+	like the real thing.
+*/
+func JoinPipeline(upstream Proc, upstreamOpts Opts, downstream Proc, downstreamOpts Opts) *PipelineProc {
+	var stages []pipelineStage
+	if pp, ok := upstream.(*PipelineProc); ok {
+		stages = append(stages, pp.stages...)
+	} else {
+		stages = append(stages, pipelineStage{upstream, upstreamOpts.Args[0], upstreamOpts.OkExit})
+	}
+	stages = append(stages, pipelineStage{downstream, downstreamOpts.Args[0], downstreamOpts.OkExit})
+
+	p := &PipelineProc{
+		state:  int32(RUNNING),
+		stages: stages,
+		exitCh: make(chan struct{}),
+	}
+	go p.waitAndHandleExit()
+	return p
+}
+
+/*
+	Returns the procs of each stage of the pipeline, from first to last.
+*/
+func (p *PipelineProc) Stages() []Proc {
+	procs := make([]Proc, len(p.stages))
+	for i, stage := range p.stages {
+		procs[i] = stage.proc
+	}
+	return procs
+}
+
+/*
+	Waits for the pipeline to exit if it has not already, then returns the
+	exit code of each stage, from first to last.  (This is the same
+	information bash reports in `$PIPESTATUS`.)
+*/
+func (p *PipelineProc) ExitCodes() []int {
+	p.Wait()
+	codes := make([]int, len(p.stages))
+	for i, stage := range p.stages {
+		codes[i] = stage.proc.GetExitCode()
+	}
+	return codes
+}
+
+/*
+	Waits for the pipeline to exit if it has not already, then returns the
+	index of the rightmost stage that exited with a status not permitted
+	by its `Opts.OkExit`, or -1 if every stage succeeded.
+*/
+func (p *PipelineProc) FailedStage() int {
+	p.Wait()
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		if !isOkExit(p.stages[i].okExit, p.stages[i].proc.ExitStatus()) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *PipelineProc) State() State {
+	return State(atomic.LoadInt32(&p.state))
+}
+
+/*
+	Returns the pid of the last process in the pipeline (this is the same
+	one a shell would report as `$!`).
+*/
+func (p *PipelineProc) Pid() int {
+	return p.stages[len(p.stages)-1].proc.Pid()
+}
+
+func (p *PipelineProc) WaitChan() <-chan struct{} {
+	return p.exitCh
+}
+
+func (p *PipelineProc) Wait() {
+	<-p.WaitChan()
+}
+
+func (p *PipelineProc) WaitSoon(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return false
+	case <-p.WaitChan():
+		return true
+	}
+}
+
+func (p *PipelineProc) GetExitCode() int {
+	if i := p.FailedStage(); i >= 0 {
+		return p.stages[i].proc.GetExitCode()
+	}
+	return p.stages[len(p.stages)-1].proc.GetExitCode()
+}
+
+/*
+	Returns the exit status of the stage whose exit code `GetExitCode()` reports.
+*/
+func (p *PipelineProc) ExitStatus() ExitStatus {
+	if i := p.FailedStage(); i >= 0 {
+		return p.stages[i].proc.ExitStatus()
+	}
+	return p.stages[len(p.stages)-1].proc.ExitStatus()
+}
+
+func (p *PipelineProc) GetExitCodeSoon(d time.Duration) int {
+	if p.WaitSoon(d) {
+		return p.GetExitCode()
+	} else {
+		return -1
+	}
+}
+
+/*
+	Returns the error of the rightmost stage that ended abnormally, if any.
+*/
+func (p *PipelineProc) Err() error {
+	if !p.State().IsDone() {
+		return nil
+	}
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		if err := p.stages[i].proc.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	Returns the combined resource usage of every stage of the pipeline:
+	CPU times, page faults and context switches are summed, `MaxRSS` is
+	the largest of any one stage, and the wall clock times span from the
+	first stage starting to the last stage ending.
+
+	Use `Stages()` to get at the usage of each stage separately.
+*/
+func (p *PipelineProc) Usage() ResourceUsage {
+	if !p.State().IsDone() {
+		return ResourceUsage{}
+	}
+	var total ResourceUsage
+	for _, stage := range p.stages {
+		u := stage.proc.Usage()
+		if total.Start.IsZero() || (!u.Start.IsZero() && u.Start.Before(total.Start)) {
+			total.Start = u.Start
+		}
+		if u.End.After(total.End) {
+			total.End = u.End
+		}
+		total.UserTime += u.UserTime
+		total.SystemTime += u.SystemTime
+		if u.MaxRSS > total.MaxRSS {
+			total.MaxRSS = u.MaxRSS
+		}
+		total.MinorFaults += u.MinorFaults
+		total.MajorFaults += u.MajorFaults
+		total.VoluntaryContextSwitches += u.VoluntaryContextSwitches
+		total.InvoluntaryContextSwitches += u.InvoluntaryContextSwitches
+	}
+	return total
+}
+
+func (p *PipelineProc) AddExitListener(callback func(Proc)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.State().IsDone() {
+		// TODO: a better standard of panic handling here
+		callback(p)
+	} else {
+		p.exitListeners = append(p.exitListeners, callback)
+	}
+}
+
+/*
+	Kills every stage of the pipeline that hasn't already exited.
+*/
+func (p *PipelineProc) Kill() {
+	for _, stage := range p.stages {
+		if !stage.proc.State().IsDone() {
+			stage.signalling(func() { stage.proc.Kill() })
+		}
+	}
+}
+
+/*
+	Sends the signal to every stage of the pipeline that hasn't already exited.
+*/
+func (p *PipelineProc) Signal(sig os.Signal) {
+	for _, stage := range p.stages {
+		if !stage.proc.State().IsDone() {
+			stage.signalling(func() { stage.proc.Signal(sig) })
+		}
+	}
+}
+
+/*
+	Sends the signal to the process group of every stage of the pipeline
+	that hasn't already exited.  (Each stage has its own group, if any;
+	see `Opts.ProcGroup`.)
+*/
+func (p *PipelineProc) SignalGroup(sig os.Signal) {
+	for _, stage := range p.stages {
+		if !stage.proc.State().IsDone() {
+			stage.signalling(func() { stage.proc.SignalGroup(sig) })
+		}
+	}
+}
+
+/*
+	Kills the process group of every stage of the pipeline that hasn't already exited.
+*/
+func (p *PipelineProc) KillGroup() {
+	for _, stage := range p.stages {
+		if !stage.proc.State().IsDone() {
+			stage.signalling(func() { stage.proc.KillGroup() })
+		}
+	}
+}
+
+//
+// Below lieth Guts
+//
+
+/*
+	Runs `fn`, which signals the stage, and shrugs off the stage having
+	exited in the meantime (between checking it's not done, and the signal
+	landing); there's nothing left to signal then.
+*/
+func (stage pipelineStage) signalling(fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			if e, ok := err.(ProcMonitorError); ok && errors.Is(e.Cause, os.ErrProcessDone) {
+				return
+			}
+			panic(err)
+		}
+	}()
+	fn()
+}
+
+func (p *PipelineProc) waitAndHandleExit() {
+	state := FINISHED
+	for _, stage := range p.stages {
+		stage.proc.Wait()
+		switch stage.proc.State() {
+		case PANICKED:
+			state = PANICKED
+		case CANCELLED:
+			if state != PANICKED {
+				state = CANCELLED
+			}
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	atomic.StoreInt32(&p.state, int32(state))
+	for _, cb := range p.exitListeners {
+		func() {
+			// TODO: a better standard of panic handling here
+			cb(p)
+		}()
+	}
+	close(p.exitCh)
+}
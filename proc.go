@@ -13,6 +13,15 @@ type Launcher func(Opts) Proc
 	It is similar to `exec.Cmd`, but applied to an in-flight process (setup
 	is performed by a separate interface).  Unlike contracts of `exec.Cmd`,
 	all functions on Proc are safe to call repeatedly, and in any order.
+
+	Note for implementors: these methods were added to this interface after
+	it was first published, so Proc implementations outside of gosh that
+	predate them no longer compile.  An implementation that can't really
+	support them can:
+	  - `Err()`: return nil (or the error that ended the proc).
+	  - `SignalGroup()` and `KillGroup()`: be the same as `Signal()` and `Kill()`.
+	  - `Usage()`: return the zero value.
+	  - `ExitStatus()`: return `ExitStatus{Exited: true, Code: code}`.
 */
 type Proc interface {
 	State() State
@@ -61,6 +70,33 @@ type Proc interface {
 	*/
 	GetExitCodeSoon(d time.Duration) int
 
+	/*
+		Waits for the command to exit if it has not already, then returns how
+		it exited: normally with an exit code, or by a signal.
+
+		Unlike `GetExitCode()`, this distinguishes a process that was
+		terminated by a signal from one that exited with a code over 128.
+	*/
+	ExitStatus() ExitStatus
+
+	/*
+		Returns the error that ended the command abnormally, or nil if the
+		command finished normally (whatever its exit code) or isn't done yet.
+
+		This is set when the state is PANICKED or CANCELLED, and is always a
+		`gosh.Error` (e.g. a `ProcMonitorError` or a `CancelledError`).
+	*/
+	Err() error
+
+	/*
+		Returns the resources the command consumed: CPU time, peak memory,
+		wall clock start and end times, and so on.
+
+		This is only available once the command is done; until then, or if
+		the implementation has no way to know, the zero value is returned.
+	*/
+	Usage() ResourceUsage
+
 	/*
 		Add a function to be called when this process completes.
 
@@ -79,7 +115,7 @@ type Proc interface {
 		to call other listeners; do not panic in a listener.
 		Consider sending any errors to a (buffered!!) channel instead.
 
-		If the command is already in the state FINISHED or PANICKED, the callback function
+		If the command is already in the state FINISHED, PANICKED, or CANCELLED, the callback function
 		will be invoked immediately in the current goroutine.
 	*/
 	AddExitListener(callback func(Proc))
@@ -87,6 +123,27 @@ type Proc interface {
 	Kill()
 
 	Signal(os.Signal)
+
+	/*
+		Sends the signal to the whole process group of the command, reaching
+		its children (and their children, etc) too.
+
+		If the command wasn't launched into a process group of its own
+		(see `Opts.ProcGroup`), this is the same as `Signal()` -- we'll never
+		signal the group gosh itself is in.
+
+		This keeps working after the command itself has exited, for as long
+		as anything it left behind is still in the group, so it can be used
+		to clean up after it.  Once the group is empty, it refuses, like
+		`Signal()` does (panicking with a `ProcMonitorError`).
+	*/
+	SignalGroup(os.Signal)
+
+	/*
+		Kills the whole process group of the command.  Exactly like
+		`SignalGroup()` with SIGKILL.
+	*/
+	KillGroup()
 }
 
 // TODO: The template system should know how to accept exit listeners up front.
@@ -0,0 +1,35 @@
+package gosh
+
+/*
+	ProcGroupMode chooses which process group a command is launched into.
+	See `Opts.ProcGroup`.
+*/
+type ProcGroupMode int
+
+const (
+	/*
+		The zero value means "not configured", which behaves the same as
+		`ProcGroupInherit`.  (It exists so that baking an `Opts` that doesn't
+		mention process groups leaves the previous setting alone.)
+	*/
+	procGroupUnset ProcGroupMode = iota
+
+	/*
+		'Inherit' leaves the process in the same process group as gosh itself.
+		This is the default, and the same as what exec does normally.
+	*/
+	ProcGroupInherit
+
+	/*
+		'New' puts the process in a new process group of its own, which its
+		children will also belong to unless they go out of their way to leave.
+		(This is what an interactive shell does for each job.)
+	*/
+	ProcGroupNew
+
+	/*
+		'Session' puts the process in a new session (and thus also a new
+		process group) of its own, detaching it from gosh's controlling terminal.
+	*/
+	ProcGroupSession
+)
@@ -33,6 +33,15 @@ const (
 		code may not be reliably known.
 	*/
 	PANICKED
+
+	/*
+		'Cancelled' is the state of a command that was stopped by gosh itself
+		before it could finish on its own -- because the `context.Context`
+		it was launched with was cancelled, or its timeout elapsed.
+
+		The exit code is whatever the process reported as it died.
+	*/
+	CANCELLED
 )
 
 /*
@@ -47,7 +56,7 @@ func (state State) IsRunning() bool {
 */
 func (state State) IsStarted() bool {
 	switch state {
-	case RUNNING, FINISHED, PANICKED:
+	case RUNNING, FINISHED, PANICKED, CANCELLED:
 		return true
 	default:
 		return false
@@ -55,11 +64,11 @@ func (state State) IsStarted() bool {
 }
 
 /*
-	Returns true if the command is finished (either gracefully, or with internal errors).
+	Returns true if the command is finished (either gracefully, with internal errors, or by cancellation).
 */
 func (state State) IsDone() bool {
 	switch state {
-	case FINISHED, PANICKED:
+	case FINISHED, PANICKED, CANCELLED:
 		return true
 	default:
 		return false
@@ -0,0 +1,62 @@
+package gosh
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+/*
+	ResourceUsage describes the resources a finished command consumed, as
+	reported by the operating system when the process was reaped.
+
+	Fields the platform doesn't report are left zero.  The page fault and
+	context switch counts in particular are only really meaningful on Linux.
+
+	Note that as with `getrusage(2)`, this covers the process itself and any
+	descendants it waited for; children that outlive it are not included.
+*/
+type ResourceUsage struct {
+	Start time.Time // wall clock time the process was launched
+	End   time.Time // wall clock time the process was seen to exit
+
+	UserTime   time.Duration // CPU time spent in user mode
+	SystemTime time.Duration // CPU time spent in the kernel
+
+	MaxRSS int64 // peak resident set size, in bytes
+
+	MinorFaults int64 // page faults serviced without any I/O
+	MajorFaults int64 // page faults that required I/O
+
+	VoluntaryContextSwitches   int64 // e.g. blocking on I/O
+	InvoluntaryContextSwitches int64 // preempted by the scheduler
+}
+
+/*
+	Returns the wall clock time the process ran for.
+*/
+func (u ResourceUsage) WallTime() time.Duration {
+	return u.End.Sub(u.Start)
+}
+
+func usageFromProcessState(start, end time.Time, state *os.ProcessState) ResourceUsage {
+	u := ResourceUsage{
+		Start:      start,
+		End:        end,
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+	}
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		u.MaxRSS = int64(rusage.Maxrss)
+		if runtime.GOOS != "darwin" {
+			// Linux (and the BSDs) report this in kilobytes; darwin in bytes.
+			u.MaxRSS *= 1024
+		}
+		u.MinorFaults = int64(rusage.Minflt)
+		u.MajorFaults = int64(rusage.Majflt)
+		u.VoluntaryContextSwitches = int64(rusage.Nvcsw)
+		u.InvoluntaryContextSwitches = int64(rusage.Nivcsw)
+	}
+	return u
+}
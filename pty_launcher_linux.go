@@ -0,0 +1,179 @@
+package gosh
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+/*
+	Launches a process via stdlib `exec`, with its stdin, stdout, and stderr
+	all attached to a new pseudo-terminal (PTY), which also becomes its
+	controlling terminal.  This is for driving programs that behave
+	differently (or refuse to run at all) when they're not talking to a TTY.
+
+	The returned `Proc` is a `*PtyProc`, through which the master side of the
+	terminal can be written to and read from.  The `In`, `Out`, and `Err` of
+	the command template are *not* used.  Note that this means something must
+	read the terminal's output as the process runs: use `Start()` rather than
+	`Run()`, or the process may block forever once it has filled the
+	terminal's (small) buffer.
+
+	If `size` is nonzero, the terminal is given that size before the
+	process starts.
+
+	The process is always launched into a new session, since that's required
+	in order to have a controlling terminal of its own (so `Opts.ProcGroup`
+	is effectively `ProcGroupSession`).  Baking a Command into `Opts.In` is
+	not supported with this launcher.
+*/
+func PtyLauncher(size WindowSize) Launcher {
+	return PtyCustomizingLauncher(size, nil)
+}
+
+/*
+	Same as `PtyLauncher`, but also gives the provided hook function a shot at
+	running against the `exec.Cmd`, just as `ExecCustomizingLauncher` does.
+*/
+func PtyCustomizingLauncher(size WindowSize, trailingHook func(*exec.Cmd)) Launcher {
+	return func(cmdt Opts) Proc {
+		master, slave, err := openPty()
+		if err != nil {
+			panic(ProcMonitorError{Cause: err})
+		}
+		defer slave.Close()
+		defer func() {
+			if err := recover(); err != nil {
+				master.Close()
+				panic(err)
+			}
+		}()
+		if size != (WindowSize{}) {
+			if err := setWindowSize(master, size); err != nil {
+				panic(ProcMonitorError{Cause: err})
+			}
+		}
+
+		cmdt.In, cmdt.Out, cmdt.Err = slave, slave, slave
+		p := execLauncher(cmdt, func(cmd *exec.Cmd) {
+			if cmd.SysProcAttr == nil {
+				cmd.SysProcAttr = &syscall.SysProcAttr{}
+			}
+			cmd.SysProcAttr.Setpgid = false
+			cmd.SysProcAttr.Setsid = true
+			cmd.SysProcAttr.Setctty = true
+			cmd.SysProcAttr.Ctty = 0 // this is an fd number *in the child*; i.e. its stdin, which is the slave.
+			if trailingHook != nil {
+				trailingHook(cmd)
+			}
+		})
+		return &PtyProc{Proc: p, master: master}
+	}
+}
+
+var _ Proc = &PtyProc{}
+
+/*
+	`gosh.Proc` for a process attached to a pseudo-terminal; see `PtyLauncher`.
+
+	All the usual `Proc` methods behave as for the underlying proc (note
+	that this includes that exit listeners are called with the underlying
+	proc, not the PtyProc).  In addition, the master side of the terminal
+	is available: writing to `In()` is like typing at the terminal, and
+	reading from `Out()` is like watching its screen.
+
+	The master side stays open after the process exits, so that any output
+	still buffered in the terminal can be read; call `Close()` when done.
+*/
+type PtyProc struct {
+	Proc
+
+	master *os.File
+}
+
+/*
+	Returns a writer that sends input to the terminal, as if typed.
+
+	Remember that the terminal is probably in "cooked" mode: the process
+	won't see anything until a newline is written, and will see
+	control characters (e.g. "\x03" for ctrl-C, "\x04" for ctrl-D)
+	as the terminal interprets them.
+*/
+func (p *PtyProc) In() io.Writer {
+	return p.master
+}
+
+/*
+	Returns a reader of everything the process writes to the terminal,
+	on both its stdout and its stderr.  (Expect "\r\n" line endings, and
+	an echo of whatever was written to `In()`.)
+
+	The reader reports EOF once the process (and any children that
+	inherited the terminal) have exited and the output is drained.
+*/
+func (p *PtyProc) Out() io.Reader {
+	return ptyMasterReader{p.master}
+}
+
+/*
+	Returns the master side of the terminal itself, for any uses not covered
+	by `In()` and `Out()` -- e.g. setting read deadlines.
+*/
+func (p *PtyProc) Master() *os.File {
+	return p.master
+}
+
+/*
+	Changes the size of the terminal.  The process will be sent SIGWINCH,
+	just as when resizing a terminal window.
+*/
+func (p *PtyProc) Resize(size WindowSize) {
+	if err := setWindowSize(p.master, size); err != nil {
+		panic(ProcMonitorError{Cause: err})
+	}
+}
+
+/*
+	Returns the current size of the terminal.
+*/
+func (p *PtyProc) WindowSize() WindowSize {
+	size, err := getWindowSize(p.master)
+	if err != nil {
+		panic(ProcMonitorError{Cause: err})
+	}
+	return size
+}
+
+/*
+	Closes the master side of the terminal.  If the process is still running,
+	it will see its terminal hang up.
+*/
+func (p *PtyProc) Close() error {
+	return p.master.Close()
+}
+
+/*
+	Returns the terminal a proc is attached to, if it was launched by
+	`PtyLauncher`.
+*/
+func ptyOf(p Proc) (terminal, bool) {
+	pp, ok := p.(*PtyProc)
+	return pp, ok
+}
+
+/*
+	Linux reports EIO when reading the master side of a terminal whose slave
+	side has been closed by everyone; that's an EOF by any other name.
+*/
+type ptyMasterReader struct {
+	f *os.File
+}
+
+func (r ptyMasterReader) Read(b []byte) (int, error) {
+	n, err := r.f.Read(b)
+	if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.EIO {
+		err = io.EOF
+	}
+	return n, err
+}
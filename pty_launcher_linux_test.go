@@ -0,0 +1,52 @@
+package gosh
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPtyLauncher(t *testing.T) {
+	Convey("Given a command launched on a pty", t, func() {
+		cmd := Gosh(Opts{Launcher: PtyLauncher(WindowSize{Rows: 24, Cols: 80})})
+
+		Convey("It should see a terminal on all its stdio", func() {
+			p := cmd.Bake("sh", "-c", "test -t 0 && test -t 1 && test -t 2 && echo tty").Start().(*PtyProc)
+			defer p.Close()
+			out, err := ioutil.ReadAll(p.Out())
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, "tty\r\n")
+			So(p.GetExitCode(), ShouldEqual, 0)
+		})
+		Convey("It should see the window size", func() {
+			p := cmd.Bake("stty", "size").Start().(*PtyProc)
+			defer p.Close()
+			out, _ := ioutil.ReadAll(p.Out())
+			So(string(out), ShouldEqual, "24 80\r\n")
+		})
+		Convey("It should be able to read input and see resizes", func() {
+			p := cmd.Bake("sh", "-c", "read x; echo got $x; stty size").Start().(*PtyProc)
+			defer p.Close()
+			p.Resize(WindowSize{Rows: 30, Cols: 100})
+			So(p.WindowSize(), ShouldResemble, WindowSize{Rows: 30, Cols: 100})
+			p.In().Write([]byte("hello\n"))
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			out, _ := ioutil.ReadAll(p.Out())
+			So(strings.Split(string(out), "\r\n"), ShouldResemble, []string{"hello", "got hello", "30 100", ""})
+		})
+	})
+
+	Convey("Given an interactive command on a pty", t, func() {
+		e := Gosh("sh", "-c", `test -t 0 && printf "tty? "; read n; echo "hello $n"`, Opts{Launcher: PtyLauncher(WindowSize{})}).Expect()
+
+		Convey("We should be able to script a conversation", func() {
+			e.Expect(`tty\? `, 1*time.Second)
+			e.SendLine("bob")
+			e.Expect(`hello bob\r\n`, 1*time.Second)
+			So(e.Wait().GetExitCode(), ShouldEqual, 0)
+		})
+	})
+}
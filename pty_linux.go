@@ -0,0 +1,92 @@
+package gosh
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+/*
+	WindowSize describes the dimensions of a terminal, in characters.
+*/
+type WindowSize struct {
+	Rows uint16
+	Cols uint16
+}
+
+/*
+	Allocates a new pseudo-terminal pair, returning the master and slave sides.
+
+	This is what `openpty(3)` does, but done by hand against `/dev/ptmx`,
+	since that's in libc and we're not.
+*/
+func openPty() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ptyNum uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&ptyNum)); err != nil {
+		master.Close()
+		return nil, nil, os.NewSyscallError("ioctl TIOCGPTN", err)
+	}
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, os.NewSyscallError("ioctl TIOCSPTLCK", err)
+	}
+	slave, err = os.OpenFile("/dev/pts/"+strconv.Itoa(int(ptyNum)), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// matches `struct winsize` from the kernel headers.
+type winsize struct {
+	rows   uint16
+	cols   uint16
+	xpixel uint16
+	ypixel uint16
+}
+
+func setWindowSize(f *os.File, size WindowSize) error {
+	ws := winsize{rows: size.Rows, cols: size.Cols}
+	if err := ioctl(f, syscall.TIOCSWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return os.NewSyscallError("ioctl TIOCSWINSZ", err)
+	}
+	return nil
+}
+
+func getWindowSize(f *os.File) (WindowSize, error) {
+	var ws winsize
+	if err := ioctl(f, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return WindowSize{}, os.NewSyscallError("ioctl TIOCGWINSZ", err)
+	}
+	return WindowSize{Rows: ws.rows, Cols: ws.cols}, nil
+}
+
+/*
+	Performs an ioctl without knocking the file out of the runtime's poller
+	(as `File.Fd()` would), so reads on it can still be interrupted by
+	deadlines and `Close()`.
+*/
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package gosh
+
+/*
+	There's no `PtyLauncher` here, so no proc is ever on a terminal.
+*/
+func ptyOf(p Proc) (terminal, bool) {
+	return nil, false
+}
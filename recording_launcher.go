@@ -0,0 +1,297 @@
+package gosh
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+/*
+	Recording is what `RecordingLauncher` saves about each command it runs,
+	and what `ReplayLauncher` serves back.  A golden file is a JSON array
+	of these.
+*/
+type Recording struct {
+	Args  []string          `json:"args"`
+	Env   map[string]string `json:"env,omitempty"`   // variables set differently than in our own environment
+	Unset []string          `json:"unset,omitempty"` // variables in our own environment that were removed
+	Cwd   string            `json:"cwd,omitempty"`
+
+	Stdin  string `json:"stdin,omitempty"` // not recorded if the input was a file; see `RecordingLauncher`
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+
+	ExitCode int `json:"exitCode"`
+	Signal   int `json:"signal,omitempty"` // if the process was terminated by a signal
+}
+
+/*
+	RecordingLauncher runs commands just like `ExecLauncher`, and records
+	each one to a golden file when it exits: its args, environment (as a
+	difference from ours), cwd, stdin, stdout, stderr, and exit status.
+	The file is rewritten after each command, so it always holds
+	everything recorded so far.
+
+		rec := gosh.NewRecordingLauncher("testdata/golden.json")
+		git := gosh.Gosh("git", gosh.Opts{Launcher: rec.Launch})
+		// ... code under test runs git ...
+		if err := rec.Err(); err != nil { ... }
+
+	Output still goes wherever it was going as well.  Input is recorded
+	as the process reads it, unless it's a file (this includes `os.Stdin`,
+	`FromFile`, and the pipes between stages of a pipeline), which is
+	handed over untouched.  Every stage of a pipeline is recorded, whatever
+	launcher the upstream commands were given.
+
+	The golden file is written from whichever goroutine noticed the process
+	exit, so if it can't be written, there's nobody to raise an error to:
+	check `Err()` once the commands are done.
+*/
+type RecordingLauncher struct {
+	path       string
+	mutex      sync.Mutex
+	recordings []Recording
+	err        error
+}
+
+/*
+	Returns a RecordingLauncher saving to the golden file at `path`.
+	Nothing is written until a command exits.
+*/
+func NewRecordingLauncher(path string) *RecordingLauncher {
+	return &RecordingLauncher{path: path}
+}
+
+/*
+	The `Launcher`.  Use this as `Opts.Launcher`.
+*/
+func (r *RecordingLauncher) Launch(cmdt Opts) Proc {
+	if in, ok := cmdt.In.(Command); ok {
+		cmdt.In = in.Bake(Opts{Launcher: r.Launch})
+	}
+	var stdin, stdout, stderr bytes.Buffer
+	p := execLauncher(cmdt, func(cmd *exec.Cmd) {
+		if _, isFile := cmd.Stdin.(*os.File); cmd.Stdin != nil && !isFile {
+			cmd.Stdin = io.TeeReader(cmd.Stdin, &stdin)
+		}
+		if cmd.Stdout != nil && sameSink(cmd.Stdout, cmd.Stderr) {
+			// the streams are about to be written separately, so the shared writer needs guarding
+			lw := &lockedWriter{w: cmd.Stdout}
+			cmd.Stdout, cmd.Stderr = lw, lw
+		}
+		cmd.Stdout = teeWriter(cmd.Stdout, &stdout)
+		cmd.Stderr = teeWriter(cmd.Stderr, &stderr)
+	})
+
+	// a pipeline is recorded stage by stage; ours is the last.
+	stage := p
+	if pp, ok := p.(*PipelineProc); ok {
+		stage = pp.stages[len(pp.stages)-1].proc
+	}
+	stage.AddExitListener(func(stage Proc) {
+		rec := Recording{
+			Args:   cmdt.Args,
+			Cwd:    cmdt.Cwd,
+			Stdin:  stdin.String(),
+			Stdout: stdout.String(),
+			Stderr: stderr.String(),
+		}
+		rec.Env, rec.Unset = envDiff(cmdt.Env)
+		status := stage.ExitStatus()
+		rec.ExitCode = status.ShellCode()
+		if status.Signaled() {
+			rec.Signal = int(status.Signal)
+		}
+		r.save(rec)
+	})
+	return p
+}
+
+/*
+	Returns the first error writing the golden file (a `RecordingFileError`),
+	or nil if every command so far has been saved.
+*/
+func (r *RecordingLauncher) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+func (r *RecordingLauncher) save(rec Recording) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.recordings = append(r.recordings, rec)
+	data, err := json.MarshalIndent(r.recordings, "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(r.path, append(data, '\n'), 0644)
+	}
+	if err != nil && r.err == nil {
+		r.err = RecordingFileError{Path: r.path, Cause: err}
+	}
+}
+
+func teeWriter(w io.Writer, record io.Writer) io.Writer {
+	if w == nil {
+		return record
+	}
+	return io.MultiWriter(w, record)
+}
+
+/*
+	Returns a Launcher that doesn't run anything, but serves up the
+	recordings in the golden file at `path` (as made by `RecordingLauncher`)
+	as if they were the commands being run: the recorded stdout and stderr
+	are written to the command's `Out` and `Err`, and the returned Proc
+	exits with the recorded status.  Commands piped into the command are
+	replayed too, whatever launcher they were given.
+
+	A recording is used for a command if it has the same args, cwd, and
+	environment (as a difference from ours).  Each recording is used only
+	once, in the order they appear in the file; so a command that was
+	recorded twice can be replayed twice.  If no unused recording matches,
+	a `NoRecordingError` is raised.  Input isn't checked against the
+	recording, or read at all.
+
+	The golden file is read right away; if it can't be, a `RecordingFileError`
+	is raised.
+*/
+func ReplayLauncher(path string) Launcher {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic(RecordingFileError{Path: path, Cause: err})
+	}
+	var recordings []Recording
+	if err := json.Unmarshal(data, &recordings); err != nil {
+		panic(RecordingFileError{Path: path, Cause: err})
+	}
+	rp := &replayer{recordings: recordings, used: make([]bool, len(recordings))}
+	return rp.launch
+}
+
+type replayer struct {
+	mutex      sync.Mutex
+	recordings []Recording
+	used       []bool
+}
+
+func (rp *replayer) launch(cmdt Opts) Proc {
+	if cmdt.Args == nil || len(cmdt.Args) < 1 {
+		panic(NoArgumentsError{})
+	}
+	rec := rp.take(cmdt)
+
+	var upstream Proc
+	var upstreamOpts Opts
+	if in, ok := cmdt.In.(Command); ok {
+		// nothing's reading its output, so throw that away
+		upstreamOpts = in.expose()
+		upstreamOpts.Out = nil
+		upstreamOpts.Launcher = rp.launch
+		upstream = upstreamOpts.start()
+	}
+
+	status := ExitStatus{Exited: true, Code: rec.ExitCode}
+	if rec.Signal != 0 {
+		status = ExitStatus{Signal: syscall.Signal(rec.Signal)}
+	}
+	p := newSyntheticProc(status)
+	outputs := setupOutputs(cmdt)
+	go func() {
+		if outputs.out != nil {
+			io.WriteString(outputs.out, rec.Stdout)
+		}
+		if outputs.err != nil {
+			io.WriteString(outputs.err, rec.Stderr)
+		}
+		for _, hook := range outputs.drainHooks {
+			hook()
+		}
+		for _, f := range outputs.files {
+			f.Close()
+		}
+		p.finish()
+	}()
+	if upstream != nil {
+		return JoinPipeline(upstream, upstreamOpts, p, cmdt)
+	}
+	return p
+}
+
+/*
+	Finds the first unused recording matching the command, and marks it used.
+*/
+func (rp *replayer) take(cmdt Opts) Recording {
+	env, unset := envDiff(cmdt.Env)
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	for i, rec := range rp.recordings {
+		if rp.used[i] {
+			continue
+		}
+		if !reflect.DeepEqual(rec.Args, cmdt.Args) || rec.Cwd != cmdt.Cwd {
+			continue
+		}
+		if !envEqual(rec.Env, env) || !reflect.DeepEqual(sortedStrings(rec.Unset), unset) {
+			continue
+		}
+		rp.used[i] = true
+		return rec
+	}
+	panic(NoRecordingError{Args: cmdt.Args, Cwd: cmdt.Cwd})
+}
+
+/*
+	Describes how `env` differs from our own environment: the variables it
+	sets differently, and those of ours it doesn't have.  A nil `env` means
+	the process inherits ours, so there's no difference.
+*/
+func envDiff(env Env) (set map[string]string, unset []string) {
+	if env == nil {
+		return nil, nil
+	}
+	ours := getOsEnv()
+	for k, v := range env {
+		if ov, ok := ours[k]; !ok || ov != v {
+			if set == nil {
+				set = make(map[string]string)
+			}
+			set[k] = v
+		}
+	}
+	for k := range ours {
+		if _, ok := env[k]; !ok {
+			unset = append(unset, k)
+		}
+	}
+	sort.Strings(unset)
+	return set, unset
+}
+
+func envEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedStrings(ss []string) []string {
+	if len(ss) == 0 {
+		return nil
+	}
+	ss = append([]string(nil), ss...)
+	sort.Strings(ss)
+	return ss
+}
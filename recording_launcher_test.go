@@ -0,0 +1,99 @@
+package gosh
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	Convey("Given a golden file", t, func() {
+		dir, err := ioutil.TempDir("", "gosh-test-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		golden := filepath.Join(dir, "golden.json")
+
+		Convey("Commands run with a RecordingLauncher should be recorded", func() {
+			recorder := NewRecordingLauncher(golden)
+			rec := Gosh(Opts{Launcher: recorder.Launch, Env: Env{"GOSH_TEST": "yes"}})
+			So(rec("echo", "hi").GetExitCode(), ShouldEqual, 0)
+			_, err := rec.Bake("sh", "-c", `cat; echo "$GOSH_TEST" >&2; exit 3`, Opts{In: "fed in\n", Out: ioutil.Discard}).RunE()
+			So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+			So(recorder.Err(), ShouldBeNil)
+
+			data, _ := ioutil.ReadFile(golden)
+			So(string(data), ShouldContainSubstring, `"stdin": "fed in\n"`)
+
+			Convey("And replayed without running anything", func() {
+				var stdout, stderr bytes.Buffer
+				rep := Gosh(Opts{Launcher: ReplayLauncher(golden), Env: Env{"GOSH_TEST": "yes"}, Out: &stdout, Err: &stderr})
+				So(rep("echo", "hi").GetExitCode(), ShouldEqual, 0)
+				So(stdout.String(), ShouldEqual, "hi\n")
+				stdout.Reset()
+
+				p, err := rep.Bake("sh", "-c", `cat; echo "$GOSH_TEST" >&2; exit 3`).RunE()
+				So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+				So(p.GetExitCode(), ShouldEqual, 3)
+				So(stdout.String(), ShouldEqual, "fed in\n")
+				So(stderr.String(), ShouldEqual, "yes\n")
+
+				Convey("Each recording should only be used once", func() {
+					_, err := rep.Bake("echo", "hi").RunE()
+					So(err, ShouldHaveSameTypeAs, NoRecordingError{})
+				})
+				Convey("Commands that differ should not match", func() {
+					_, err := rep.Bake("echo", "hi", Env{"GOSH_TEST": "no"}).RunE()
+					So(err, ShouldHaveSameTypeAs, NoRecordingError{})
+				})
+			})
+		})
+
+		Convey("Redirected output should be recorded and still reach the file", func() {
+			path := filepath.Join(dir, "out")
+			rec := Gosh(Opts{Launcher: NewRecordingLauncher(golden).Launch})
+			rec("sh", "-c", "sleep 0.1; echo hi", Opts{Out: File(path)})
+			content, _ := ioutil.ReadFile(path)
+			So(string(content), ShouldEqual, "hi\n")
+			data, _ := ioutil.ReadFile(golden)
+			So(string(data), ShouldContainSubstring, `"stdout": "hi\n"`)
+		})
+
+		Convey("Every stage of a pipeline should be recorded, and replayed", func() {
+			recorder := NewRecordingLauncher(golden)
+			Pipe(Gosh("echo", "b\na"), Gosh("sort", Opts{Launcher: recorder.Launch})).Run()
+			data, _ := ioutil.ReadFile(golden)
+			So(string(data), ShouldContainSubstring, `"stdout": "b\na\n"`)
+
+			var stdout bytes.Buffer
+			p := Pipe(
+				Gosh("echo", "b\na"),
+				Gosh("sort", Opts{Launcher: ReplayLauncher(golden), Out: &stdout}),
+			).Run()
+			So(stdout.String(), ShouldEqual, "a\nb\n")
+			for _, stage := range p.(*PipelineProc).Stages() {
+				_, synthetic := stage.(*syntheticProc)
+				So(synthetic, ShouldBeTrue)
+			}
+		})
+
+		Convey("Failing to write the golden file should be reported, not raised", func() {
+			recorder := NewRecordingLauncher(filepath.Join(dir, "nope", "golden.json"))
+			So(Gosh("echo", "hi", Opts{Launcher: recorder.Launch, Out: ioutil.Discard})().GetExitCode(), ShouldEqual, 0)
+			So(recorder.Err(), ShouldHaveSameTypeAs, RecordingFileError{})
+		})
+
+		Convey("Replays should work for commands that aren't even installed", func() {
+			ioutil.WriteFile(golden, []byte(`[{"args": ["gosh-not-installed", "status"], "stdout": "clean\n", "stderr": "", "exitCode": 0}]`), 0644)
+			cmd := Gosh("gosh-not-installed", Opts{Launcher: ReplayLauncher(golden)})
+			So(cmd.Bake("status").Output(), ShouldEqual, "clean\n")
+		})
+
+		Convey("Replaying from a missing file should fail", func() {
+			So(func() { ReplayLauncher(golden) }, ShouldPanic)
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package gosh
+
+import (
+	"errors"
+	"os"
+)
+
+/*
+	Redirect names a file for `Opts.In`, `Opts.Out` or `Opts.Err` to be
+	connected to, like `<`, `>` and `>>` in a shell.  Make them with
+	`FromFile`, `File` and `Append`.
+
+	The file is opened when the command is launched, and handed straight
+	to the process (there's no copying through gosh); gosh's own copy of
+	it is closed as soon as the process has been started.
+
+	If the same Redirect is given for both Out and Err, they share the
+	file, like `>out.log 2>&1`.
+*/
+type Redirect struct {
+	Path string
+	mode redirectMode
+}
+
+type redirectMode int
+
+const (
+	redirectRead redirectMode = iota + 1
+	redirectTruncate
+	redirectAppend
+)
+
+/*
+	The permissions files created by `File` and `Append` get (before umask).
+*/
+const RedirectPerm os.FileMode = 0644
+
+/*
+	Redirects output to the file at `path`, creating it if necessary, and
+	truncating it if it already exists.  (Like `>` in a shell.)
+*/
+func File(path string) Redirect {
+	return Redirect{path, redirectTruncate}
+}
+
+/*
+	Redirects output to the end of the file at `path`, creating it if
+	necessary.  (Like `>>` in a shell.)
+*/
+func Append(path string) Redirect {
+	return Redirect{path, redirectAppend}
+}
+
+/*
+	Redirects input from the file at `path`.  (Like `<` in a shell.)
+*/
+func FromFile(path string) Redirect {
+	return Redirect{path, redirectRead}
+}
+
+/*
+	Opens the file.  Panics with a `RedirectError` if it can't be opened, or
+	if it's being used the wrong way round (e.g. `File` for input).
+*/
+func (r Redirect) open(forWriting bool) *os.File {
+	var flag int
+	switch r.mode {
+	case redirectRead:
+		if forWriting {
+			panic(RedirectError{Path: r.Path, Cause: errors.New("file is for input, but was used for output")})
+		}
+		flag = os.O_RDONLY
+	case redirectTruncate, redirectAppend:
+		if !forWriting {
+			panic(RedirectError{Path: r.Path, Cause: errors.New("file is for output, but was used for input")})
+		}
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if r.mode == redirectAppend {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+	default:
+		panic(RedirectError{Path: r.Path, Cause: errors.New("not made by File, Append, or FromFile")})
+	}
+	f, err := os.OpenFile(r.Path, flag, RedirectPerm)
+	if err != nil {
+		panic(RedirectError{Path: r.Path, Cause: err})
+	}
+	return f
+}
@@ -0,0 +1,211 @@
+package gosh
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	Renders the command as a line of shell that would run it: environment
+	changes (as a difference from ours), cwd, the args, and redirections.
+	Everything is quoted so it can be pasted into a shell as-is.
+
+	Only what a shell can express is rendered.  Input given as a string or
+	bytes is fed in with `printf`, and a Command given as input is rendered
+	as the preceding stage of a pipeline; other readers and writers (buffers,
+	channels, and so on) are left out, as are things like `Timeout`.
+
+	For example, `Gosh("grep", "-r", "TODO", Opts{Cwd: "src", Out: File("todo")})`
+	renders as `cd src && grep -r TODO >todo` (`Gosh()`'s default environment
+	is the same as ours, so there's nothing to render for it).
+*/
+func (cmdt Opts) String() string {
+	return cmdt.renderStage(false, false)
+}
+
+/*
+	Like `String()`, but with the values of environment variables left
+	out (as `K=...`), since they're so often secrets.  This is what goes
+	into error messages, which tend to end up in logs.
+*/
+func (cmdt Opts) redactedString() string {
+	return cmdt.renderStage(false, true)
+}
+
+/*
+	Renders the command as a line of shell that would run it.
+	See `Opts.String()`.
+*/
+func (c Command) String() string {
+	return c.expose().String()
+}
+
+/*
+	Renders the command, and any commands piped into it.  If the command
+	is feeding a pipe itself (`piped`), or is fed by one, and it needs a
+	`cd`, it's put in a subshell so the `cd` doesn't affect the other side.
+	If `redact` is set, environment variables' values are left out.
+*/
+func (cmdt Opts) renderStage(piped, redact bool) string {
+	var upstream, words []string
+	switch in := cmdt.In.(type) {
+	case Command:
+		upOpts := in.expose()
+		upOpts.Out = os.Stdout // it goes to the pipe, whatever it says
+		upstream = append(upstream, upOpts.renderStage(true, redact), "|")
+		piped = true
+	case string:
+		upstream = append(upstream, "printf", "%s", shellQuote(in), "|")
+		piped = true
+	case []byte:
+		upstream = append(upstream, "printf", "%s", shellQuote(string(in)), "|")
+		piped = true
+	}
+
+	words = append(words, renderEnv(cmdt.Env, redact)...)
+	for i, arg := range cmdt.Args {
+		if i == 0 && strings.Contains(arg, "=") {
+			// unquoted, the command name would read as an env assignment
+			words = append(words, quoteAlways(arg))
+		} else {
+			words = append(words, shellQuote(arg))
+		}
+	}
+	if r, ok := cmdt.In.(Redirect); ok {
+		words = append(words, renderRedirect(r))
+	}
+	out := renderOutput(cmdt.Out, os.Stdout)
+	switch {
+	case cmdt.Err != nil && sameSink(cmdt.Err, cmdt.Out):
+		words = appendNonEmpty(words, out, "2>&1")
+	case cmdt.Err == os.Stdout:
+		// our stdout, not wherever the process's is redirected to
+		words = appendNonEmpty(words, "2>&1", out)
+	default:
+		words = appendNonEmpty(words, out)
+		if err := renderOutput(cmdt.Err, os.Stderr); err != "" {
+			words = append(words, "2"+err)
+		}
+	}
+	fds := make([]int, 0, len(cmdt.ExtraFD))
+	for fd := range cmdt.ExtraFD {
+		fds = append(fds, fd)
+	}
+	sort.Ints(fds)
+	for _, fd := range fds {
+		if r, ok := cmdt.ExtraFD[fd].(Redirect); ok {
+			words = append(words, strconv.Itoa(fd)+renderRedirect(r))
+		}
+	}
+
+	line := strings.Join(words, " ")
+	if cmdt.Cwd != "" {
+		line = "cd " + shellQuote(cmdt.Cwd) + " && " + line
+		if piped {
+			line = "(" + line + ")"
+		}
+	}
+	return strings.Join(append(upstream, line), " ")
+}
+
+/*
+	Renders where output goes, as a redirection (without the fd number).
+	Returns "" if it goes to `dflt`, or somewhere that isn't a file a
+	shell could name.
+*/
+func renderOutput(sink interface{}, dflt *os.File) string {
+	if sink == ioutil.Discard {
+		return ">/dev/null"
+	}
+	switch s := sink.(type) {
+	case nil:
+		return ">/dev/null"
+	case Redirect:
+		return renderRedirect(s)
+	case *os.File:
+		switch s {
+		case dflt:
+			return ""
+		case os.Stdout:
+			return ">&1"
+		case os.Stderr:
+			return ">&2"
+		}
+	}
+	return ""
+}
+
+func appendNonEmpty(words []string, more ...string) []string {
+	for _, w := range more {
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+func renderRedirect(r Redirect) string {
+	switch r.mode {
+	case redirectRead:
+		return "<" + shellQuote(r.Path)
+	case redirectAppend:
+		return ">>" + shellQuote(r.Path)
+	default:
+		return ">" + shellQuote(r.Path)
+	}
+}
+
+/*
+	Renders how `env` differs from our own environment, as `K=v` words
+	to go before the args, and an `env` invocation if any variables need
+	removing.  (A nil `env` means the process inherits ours.)  If `redact`
+	is set, the values are rendered as `...`.
+*/
+func renderEnv(env Env, redact bool) []string {
+	set, unset := envDiff(env)
+	var words []string
+	if len(unset) > 0 {
+		if len(env) == len(set) {
+			// nothing of ours is kept, so start from nothing
+			words = append(words, "env", "-i")
+		} else {
+			words = append(words, "env")
+			for _, k := range unset {
+				words = append(words, "-u", shellQuote(k))
+			}
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if redact {
+			words = append(words, k+"=...")
+		} else {
+			words = append(words, k+"="+shellQuote(set[k]))
+		}
+	}
+	return words
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+/*
+	Quotes `s` for a POSIX shell, if it needs it.
+*/
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return quoteAlways(s)
+}
+
+func quoteAlways(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
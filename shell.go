@@ -1,9 +1,13 @@
 package gosh
 
 import (
-	"bytes"
+	"context"
+	"io"
 	"os"
 	"strconv"
+	"time"
+
+	"github.com/polydawn/gosh/iox"
 )
 
 /*
@@ -18,10 +22,14 @@ func Sh(args ...interface{}) Proc {
 
 /*
 	Creates a new Command with the defaults for shell-like behavior.
+
+	Commands are launched with `ExecLauncher`; or, if the `GOSH_DRYRUN`
+	environment variable is set to true, with `DryRunLauncher`, so they're
+	only printed.
 */
 func Gosh(args ...interface{}) Command {
 	return enclose(bake(Opts{
-		Launcher: ExecLauncher,
+		Launcher: defaultLauncher(),
 		Env:      getOsEnv(),
 		In:       os.Stdin,
 		Out:      os.Stdout,
@@ -30,6 +38,35 @@ func Gosh(args ...interface{}) Command {
 	}, args...))
 }
 
+/*
+	Joins several Commands into a pipeline, like `a | b | c` in a shell:
+	the output of each command is fed to the input of the next, by way of
+	OS pipes (no goroutines shuttle the data).
+
+	The returned Command can be run, started, baked, etc, just like any
+	other.  Arguments baked into it apply to the last stage of the pipeline
+	(so e.g. `Pipe(a, b).Output()` collects the output of `b`).
+	The stdin of the first stage and the stderr of every stage are left
+	as they were configured in each Command.
+
+	Launching it gives a `*PipelineProc`, which can report the exit code
+	of each stage.  Running it panics with a FailureExitCode if any stage
+	exits with a status not permitted by its own `Opts.OkExit`; the error
+	names the rightmost such stage (i.e., like bash with "pipefail" set).
+
+	This is shorthand for giving each Command as `Opts.In` to the next.
+*/
+func Pipe(cmds ...Command) Command {
+	if len(cmds) == 0 {
+		panic(NoArgumentsError{})
+	}
+	pipeline := cmds[0]
+	for _, cmd := range cmds[1:] {
+		pipeline = cmd.Bake(Opts{In: pipeline})
+	}
+	return pipeline
+}
+
 /*
 	Calling a `Command` merges in the arguments and then
 	immediately launches a `Proc`.  The `Command()` call waits for the `Proc`
@@ -39,6 +76,7 @@ func Gosh(args ...interface{}) Command {
 	  - `string` or `[]string` types will be merged into the command args list.
 	  - `Env` types will be joined with the command environment variables.
 	  - `ClearEnv` will discard *all* current environment variables.
+	  - `context.Context` values will be used as the command's context (see `Opts.Context`).
 	  - `Opts` objects can do all of the above, and also
 	    set the working directory,
 		set the input and output streams,
@@ -99,6 +137,23 @@ func (c Command) Run() Proc {
 	return c.expose().run()
 }
 
+/*
+	Like `Run()`, but returns an error instead of panicking.
+
+	The error is the same `gosh.Error` value that `Run()` would have
+	panicked with (e.g. a `FailureExitCode`, or a `NoSuchCommandError`),
+	so it can be picked apart with a type switch or `errors.As`.
+	The `Proc` is returned whenever the command was launched, even if it
+	then failed, so that e.g. its exit code can still be inspected.
+
+	These "E" variants are meant for long-running applications, where
+	a panic is not a welcome way to hear that a subprocess failed;
+	they never panic for any reason other than bugs.
+*/
+func (c Command) RunE() (Proc, error) {
+	return c.expose().runE()
+}
+
 /*
 	Starts execution of the command, and immediately returns a `Proc` that
 	can be used to track execution of the command, configure exit listeners,
@@ -109,34 +164,124 @@ func (c Command) Start() Proc {
 }
 
 /*
-	Like `Run()`, but overrides stdout and stderr to be collected and reported
-	along with the error that is raised if the process ends with a non-zero exit status.
+	Like `Start()`, but returns an error instead of panicking if the command
+	cannot be launched.  See `RunE()`.
+*/
+func (c Command) StartE() (p Proc, err error) {
+	defer recoverError(&err)
+	return c.expose().start(), nil
+}
+
+/*
+	Like `Run()`, but collects stdout and stderr to be reported along with
+	the error that is raised if the process ends with a non-zero exit status.
+
+	The output is only collected: `Out` and `Err` are ignored, so nothing
+	is shown unless the command fails.  Use `RunAndReportLive()` to also
+	send the output on to them as it happens.
 
 	The conmingled stdout+stderr will be in the `FailureExitCode.Message`
-	field.
+	field.  Each stream is also reported separately, in the `Stdout` and
+	`Stderr` fields, and `FailureExitCode.Transcript()` says which output
+	went to which stream, in order, so e.g. `Transcript().String()` gives a
+	rendering with every line tagged "out" or "err".
 
 	This is often a useful helper method for the behavior an application wants
 	from a non-interactive background task (e.g. "untar; if it succeeds, I already
 	understand what that means; tell me the output if and only if it fails").
 
-	Note that this implies that stdout and stderr of the process will be
-	buffered by gosh in memory.  If your process may produce large amounts of
-	output, this helper method may not be appropriate for your use case.
+	Only the first and last part of the output is kept in memory, so this is
+	safe to use even if the process may produce huge amounts of output:
+	by default, `DefaultReportCapture`; set `Opts.Capture` to change that.
 */
 func (c Command) RunAndReport() Proc {
-	var buf bytes.Buffer
+	p, err := c.runAndReport(false)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+/*
+	Like `RunAndReport()`, but returns an error instead of panicking.  See `RunE()`.
+*/
+func (c Command) RunAndReportE() (p Proc, err error) {
+	defer recoverError(&err)
+	return c.runAndReport(false)
+}
+
+/*
+	Like `RunAndReport()`, but the output also goes to `Out` and `Err` as
+	it happens, so e.g. with `Gosh()`'s defaults of `os.Stdout` and
+	`os.Stderr` you can watch the command work, and still get the output
+	in the error if it fails.
+
+	`CloseOut` and `CloseErr` apply to the channels among `Out` and `Err`,
+	as usual.
+*/
+func (c Command) RunAndReportLive() Proc {
+	p, err := c.runAndReport(true)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+/*
+	Like `RunAndReportLive()`, but returns an error instead of panicking.  See `RunE()`.
+*/
+func (c Command) RunAndReportLiveE() (p Proc, err error) {
+	defer recoverError(&err)
+	return c.runAndReport(true)
+}
+
+func (c Command) runAndReport(live bool) (Proc, error) {
 	cmdt := c.expose()
-	cmdt.Out = &buf
-	cmdt.Err = &buf
-	p := cmdt.start()
-	p.Wait()
-	exitCode := p.GetExitCode()
-	for _, okcode := range cmdt.OkExit {
-		if exitCode == okcode {
-			return p
+	outBuf := cmdt.Capture.buffer(DefaultReportCapture)
+	errBuf := cmdt.Capture.buffer(DefaultReportCapture)
+	rec := newTranscriptRecorder(cmdt.Capture.resolve(DefaultReportCapture))
+	var liveOut, liveErr interface{}
+	if live {
+		liveOut, liveErr = cmdt.Out, cmdt.Err
+	} else {
+		cmdt.CloseOut, cmdt.CloseErr = false, false
+	}
+	shared := liveOut != nil && sameSink(liveOut, liveErr)
+	// files have to be opened here, since the tee is what's going to write to them
+	for _, live := range []*interface{}{&liveOut, &liveErr} {
+		if r, ok := (*live).(Redirect); ok && !(shared && live == &liveErr) {
+			f := r.open(true)
+			defer f.Close()
+			*live = f
+		}
+	}
+	var sharedCloser io.Closer
+	if shared {
+		// the two streams are going to be written separately now, so the shared sink needs guarding
+		w := &lockedWriter{w: iox.WriterFromInterface(liveOut)}
+		if (cmdt.CloseOut || cmdt.CloseErr) && iox.IsChanSink(liveOut) {
+			// the tees can't see it's a channel any more, so it's up to us
+			sharedCloser = w.w.(io.Closer)
+			cmdt.CloseOut, cmdt.CloseErr = false, false
 		}
+		liveOut, liveErr = w, w
+	}
+	cmdt.Out = teeIfLive(liveOut, io.MultiWriter(outBuf, rec.stream(StreamOut)))
+	cmdt.Err = teeIfLive(liveErr, io.MultiWriter(errBuf, rec.stream(StreamErr)))
+	p := cmdt.start()
+	err := cmdt.wait(p)
+	if sharedCloser != nil {
+		sharedCloser.Close()
+	}
+	if exitErr, ok := err.(FailureExitCode); ok {
+		transcript := rec.transcript()
+		exitErr.transcript = &transcript
+		exitErr.Message = transcript.Text()
+		exitErr.Stdout = outBuf.String()
+		exitErr.Stderr = errBuf.String()
+		return p, exitErr
 	}
-	panic(FailureExitCode{Cmdname: cmdt.Args[0], Code: exitCode, Message: buf.String()})
+	return p, err
 }
 
 /*
@@ -149,22 +294,45 @@ func (c Command) RunAndReport() Proc {
 	This is shorthand equivalent to `Bake(Opts{Out:val}).Run()`; that is, it will
 	overrule any previously configured output, and also it has no effect on where
 	stderr will go.
+
+	All the output is kept in memory, unless limited by `Opts.Capture`.
 */
 func (c Command) Output() string {
-	var buf bytes.Buffer
-	c.Bake(Opts{Out: &buf}).Run()
+	buf := c.expose().Capture.buffer(CaptureAll)
+	c.Bake(Opts{Out: buf}).Run()
 	return buf.String()
 }
 
+/*
+	Like `Output()`, but returns an error instead of panicking.  See `RunE()`.
+	Whatever output was collected is returned even if there's an error.
+*/
+func (c Command) OutputE() (out string, err error) {
+	defer recoverError(&err)
+	buf := c.expose().Capture.buffer(CaptureAll)
+	_, err = c.Bake(Opts{Out: buf}).RunE()
+	return buf.String(), err
+}
+
 /*
 	Same as `Output()`, but acts on both stdout and stderr.
 */
 func (c Command) CombinedOutput() string {
-	var buf bytes.Buffer
-	c.Bake(Opts{Out: &buf, Err: &buf}).Run()
+	buf := c.expose().Capture.buffer(CaptureAll)
+	c.Bake(Opts{Out: buf, Err: buf}).Run()
 	return buf.String()
 }
 
+/*
+	Like `CombinedOutput()`, but returns an error instead of panicking.  See `RunE()`.
+*/
+func (c Command) CombinedOutputE() (out string, err error) {
+	defer recoverError(&err)
+	buf := c.expose().Capture.buffer(CaptureAll)
+	_, err = c.Bake(Opts{Out: buf, Err: buf}).RunE()
+	return buf.String(), err
+}
+
 type Opts struct {
 	Args []string
 
@@ -181,6 +349,11 @@ type Opts struct {
 		  - <-chan string, in which case that will be streamed in
 		  - <-chan byte[], in which case that will be streamed in
 		  - another Command, in which case that will be started with this one and its output piped into this one
+		  - a Redirect from `FromFile`, in which case the file will be opened and given to the process directly
+
+		When In is a Command, the two processes are joined by an OS pipe (no
+		goroutines shuttle the data), and the `Proc` returned stands for the
+		whole pipeline; see `PipelineProc`.
 	*/
 	In interface{}
 
@@ -188,8 +361,10 @@ type Opts struct {
 		Can be a:
 		  - bytes.Buffer, which will be written to literally
 		  - io.Writer, which will be written to streamingly, flushed to whenever the command flushes
-		  - chan<- string, which will be written to streamingly, flushed to whenever a line break occurs in the output
-		  - chan<- byte[], which will be written to streamingly, flushed to whenever the command flushes
+		  - chan<- string, which will be sent each line of the output as it's completed (including the line break; a final unterminated line is sent when the command exits)
+		  - chan<- byte[], which will be written to streamingly, flushed to whenever the command flushes (each slice sent is a fresh copy, owned by the receiver; see iox.WriterToChanByteSlicePooled for a cheaper option)
+		  - []interface{} of any of the above, which will all be sent the same output (see iox.Tee; channels in it are written to without blocking the others)
+		  - a Redirect from `File` or `Append`, in which case the file will be opened and given to the process directly
 
 		(There's nothing that's quite the equivalent of how you can give In a string, sadly; since
 		strings are immutable in golang, you can't set Out=&str and get anywhere.)
@@ -201,12 +376,120 @@ type Opts struct {
 	*/
 	Err interface{}
 
+	/*
+		If set, and Out is a channel, gosh closes the channel once the
+		command has exited and all its output has been sent -- so whatever is
+		ranging over the channel finishes by itself.  If Out is a tee
+		(a `[]interface{}` of sinks), the channels among them are closed.
+
+		Leave this off if anything else is going to send on the channel
+		after this command (e.g. several commands sharing one channel).
+	*/
+	CloseOut bool
+
+	/*
+		Like CloseOut, but for Err.  (If Out and Err are the same channel,
+		setting either one is enough; it's only closed once.)
+	*/
+	CloseErr bool
+
+	/*
+		Extra file descriptors for the process, beyond In, Out and Err,
+		keyed by fd number (so 3 and up).  Values can be:
+		  - anything In can be, for the process to read from
+		  - anything Out can be, for the process to write to (including *bytes.Buffer)
+		  - an *os.File, which is handed over as-is
+
+		Things that could go either way (like a `chan string`) need marking
+		with `ExtraIn` or `ExtraOut`.  As with Out, output is all in before
+		the command is done.
+	*/
+	ExtraFD map[int]interface{}
+
 	/*
 		Exit status codes that are to be considered "successful".  If not provided, [0] is the default.
 		(If this slice is provided, zero will -not- be considered a success code unless explicitly included.)
+
+		A process terminated by a signal is not considered successful, unless
+		the slice includes the value returned by `SignalExit()` for that signal,
+		or the 128+signal code a shell would report (e.g. 137 for SIGKILL).
+		The latter also accepts a process that exits normally with that code;
+		use `SignalExit()` to accept only the signal.
 	*/
 	OkExit []int
 
+	/*
+		If set, the process is tied to the lifetime of this context: when the
+		context is done, the process is stopped (see `StopSignal`).
+
+		A command stopped this way ends in the state `CANCELLED`, and `Run()`
+		will panic with a `CancelledError`.  If the context is already done
+		when the command is launched, it is not started at all.
+
+		When this command's input is another Command (a pipeline), the context
+		applies to the upstream stages too, unless they have one of their own.
+	*/
+	Context context.Context
+
+	/*
+		If nonzero, the process is stopped (see `StopSignal`) if it hasn't
+		exited on its own within this long after launch.
+
+		A command stopped this way ends in the state `CANCELLED`, and `Run()`
+		will panic with a `TimeoutError`.
+
+		When this command's input is another Command (a pipeline), the timeout
+		applies to the upstream stages too, unless they have one of their own.
+	*/
+	Timeout time.Duration
+
+	/*
+		The signal used to ask the process to stop when gosh gives up on it
+		(because of `Timeout` or `Context`).  If not provided, SIGTERM is the default.
+	*/
+	StopSignal os.Signal
+
+	/*
+		How long a process is given to exit after being sent the `StopSignal`,
+		before it's killed outright.  If not provided, 5 seconds is the default.
+	*/
+	StopGrace time.Duration
+
+	/*
+		Which process group to launch the process into.  If not provided,
+		the process stays in gosh's own group (`ProcGroupInherit`).
+
+		Launching into a group of its own (`ProcGroupNew` or `ProcGroupSession`)
+		makes it possible to signal the process and all of its descendants
+		at once; see `Proc.SignalGroup()` and `Proc.KillGroup()`.
+	*/
+	ProcGroup ProcGroupMode
+
+	/*
+		If true, when gosh stops the process (because of `Timeout` or `Context`),
+		the stop signal and the kill are sent to the process's whole group rather
+		than just the process itself, so that e.g. the children of a shell
+		wrapper don't survive as orphans.
+
+		Has no effect unless `ProcGroup` gives the process a group of its own.
+		(Note that since false means "not configured", baking in a false value
+		will not turn this back off.)
+	*/
+	StopGroup bool
+
+	/*
+		How much output the capturing helpers -- `Output()`,
+		`CombinedOutput()` and `RunAndReport()` -- keep in memory.
+		See `CaptureLimit`.
+	*/
+	Capture CaptureLimit
+
+	/*
+		Marks up each line of output with a label and/or timestamp.
+		See `Decoration`.
+	*/
+	Decorate Decoration
+
 	/*
 		The `Launcher` to use when spawning a process from this template.
 
@@ -232,9 +515,49 @@ func (x Opts) Merge(y Opts) Opts {
 	if y.Err != nil {
 		x.Err = y.Err
 	}
+	if y.ExtraFD != nil {
+		fds := make(map[int]interface{}, len(x.ExtraFD)+len(y.ExtraFD))
+		for fd, v := range x.ExtraFD {
+			fds[fd] = v
+		}
+		for fd, v := range y.ExtraFD {
+			fds[fd] = v
+		}
+		x.ExtraFD = fds
+	}
 	if y.OkExit != nil {
 		x.OkExit = y.OkExit
 	}
+	if y.Context != nil {
+		x.Context = y.Context
+	}
+	if y.Timeout != 0 {
+		x.Timeout = y.Timeout
+	}
+	if y.StopSignal != nil {
+		x.StopSignal = y.StopSignal
+	}
+	if y.StopGrace != 0 {
+		x.StopGrace = y.StopGrace
+	}
+	if y.ProcGroup != procGroupUnset {
+		x.ProcGroup = y.ProcGroup
+	}
+	if y.StopGroup {
+		x.StopGroup = true
+	}
+	if y.CloseOut {
+		x.CloseOut = true
+	}
+	if y.CloseErr {
+		x.CloseErr = true
+	}
+	if y.Capture != (CaptureLimit{}) {
+		x.Capture = y.Capture
+	}
+	if y.Decorate != (Decoration{}) {
+		x.Decorate = y.Decorate
+	}
 	if y.Launcher != nil {
 		x.Launcher = y.Launcher
 	}
@@ -247,14 +570,69 @@ func (cmdt Opts) start() Proc {
 
 func (cmdt Opts) run() Proc {
 	p := cmdt.start()
+	if err := cmdt.wait(p); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (cmdt Opts) runE() (p Proc, err error) {
+	defer recoverError(&err)
+	p = cmdt.start()
+	return p, cmdt.wait(p)
+}
+
+/*
+	Waits for the proc to finish, then returns an error if it ended
+	abnormally or exited with a status the template doesn't consider
+	successful, or nil if all is well.
+*/
+func (cmdt Opts) wait(p Proc) error {
 	p.Wait()
-	exitCode := p.GetExitCode()
-	for _, okcode := range cmdt.OkExit {
-		if exitCode == okcode {
-			return p
+	if err := p.Err(); err != nil {
+		return err
+	}
+	if err := cmdt.checkExit(p); err != nil {
+		return *err
+	}
+	return nil
+}
+
+/*
+	Returns a FailureExitCode if the proc exited with a status the template
+	doesn't consider successful, or nil if all is well.
+
+	If the proc is a pipeline, every stage is checked against the `OkExit`
+	of the template it was launched from, and the rightmost failing stage
+	is the one reported (i.e., like bash with "pipefail" set).
+*/
+func (cmdt Opts) checkExit(p Proc) *FailureExitCode {
+	if pp, ok := p.(*PipelineProc); ok {
+		i := pp.FailedStage()
+		if i < 0 {
+			return nil
 		}
+		status := pp.stages[i].proc.ExitStatus()
+		return &FailureExitCode{
+			Cmdname:         pp.stages[i].name,
+			Cmdline:         cmdt.String(),
+			Code:            status.ShellCode(),
+			Status:          status,
+			PipelineStage:   i + 1,
+			redactedCmdline: cmdt.redactedString(),
+		}
+	}
+	status := p.ExitStatus()
+	if isOkExit(cmdt.OkExit, status) {
+		return nil
+	}
+	return &FailureExitCode{
+		Cmdname:         cmdt.Args[0],
+		Cmdline:         cmdt.String(),
+		Code:            status.ShellCode(),
+		Status:          status,
+		redactedCmdline: cmdt.redactedString(),
 	}
-	panic(FailureExitCode{Cmdname: cmdt.Args[0], Code: exitCode})
 }
 
 type magic struct{ cmdt Opts }
@@ -296,6 +674,8 @@ func bake(cmdt Opts, args ...interface{}) Opts {
 			cmdt = cmdt.Merge(Opts{Args: []string{strconv.Itoa(arg)}})
 		case []string:
 			cmdt = cmdt.Merge(Opts{Args: arg})
+		case context.Context:
+			cmdt = cmdt.Merge(Opts{Context: arg})
 		default:
 			panic(IncomprehensibleCommandModifierError{wat: &arg})
 		}
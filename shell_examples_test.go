@@ -1,6 +1,7 @@
 package gosh_test
 
 import (
+	"errors"
 	"fmt"
 
 	. "github.com/polydawn/gosh"
@@ -48,6 +49,17 @@ func ExampleErrorExit() {
 	// code 22
 }
 
+func ExampleCommand_RunE() {
+	_, err := Gosh("bash", "-c", "exit 22").RunE()
+	var exitErr FailureExitCode
+	if errors.As(err, &exitErr) {
+		fmt.Println("code", exitErr.Code)
+	}
+
+	// Output:
+	// code 22
+}
+
 func ExampleOkExit() {
 	Sh("bash", "-c", "exit 22", Opts{OkExit: AnyExit})
 	// (no output; point is just that it doesn't panic)
@@ -83,6 +95,47 @@ func ExamplePipelineBetter() {
 	// 3
 }
 
+func ExampleOpts_closeOut() {
+	// let gosh close the channel when the first task is done with it
+	pipe := make(chan string)
+	job1 := Gosh("echo", "3\n1\n2", Opts{Out: pipe, CloseOut: true}).Start()
+	job2 := Gosh("sort", Opts{In: pipe}).Start()
+	job1.Wait()
+	job2.Wait()
+
+	// Output:
+	// 1
+	// 2
+	// 3
+}
+
+func ExamplePipe() {
+	// the stages are joined by real pipes; no need to manage channels
+	Pipe(
+		Gosh("echo", "3\n1\n2"),
+		Gosh("sort"),
+		Gosh("head", "-n", "2"),
+	).Run()
+
+	// Output:
+	// 1
+	// 2
+}
+
+func ExamplePipe_failure() {
+	defer func() {
+		err := recover().(FailureExitCode)
+		fmt.Println(err.Cmdname, "in stage", err.PipelineStage, "exited", err.Code)
+	}()
+	Pipe(
+		Gosh("sh", "-c", "exit 4"),
+		Gosh("cat"),
+	).Run()
+
+	// Output:
+	// sh in stage 1 exited 4
+}
+
 func ExampleBakingAShell() {
 	shell := Gosh("bash", "-c")
 	shell("echo 'this is a shell eval'")
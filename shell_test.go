@@ -2,7 +2,18 @@ package gosh
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -101,4 +112,805 @@ func TestExecIntegration(t *testing.T) {
 			})
 		})
 	})
+
+	Convey("Given a command writing lines in dribs and drabs to a channel", t, func() {
+		ch := make(chan string, 10)
+		cmd := Gosh("sh", "-c", `printf "a"; sleep 0.01; printf "b\nc\nd"`, Opts{Out: ch})
+
+		Convey("The channel should receive whole lines", func() {
+			cmd.Run()
+			So(len(ch), ShouldEqual, 3)
+			So(<-ch, ShouldEqual, "ab\n")
+			So(<-ch, ShouldEqual, "c\n")
+			So(<-ch, ShouldEqual, "d")
+		})
+	})
+
+	Convey("Given a command writing both streams to a channel it closes", t, func() {
+		ch := make(chan string, 10)
+		cmd := Gosh("sh", "-c", "echo out; echo err >&2; printf end", Opts{Out: ch, Err: ch, CloseOut: true, CloseErr: true})
+
+		Convey("The channel should be closed once, after all output", func() {
+			cmd.Run()
+			var lines []string
+			for line := range ch {
+				lines = append(lines, line)
+			}
+			So(lines, ShouldResemble, []string{"out\n", "err\n", "end"})
+		})
+		Convey("The channel should be closed even if the command can't start", func() {
+			So(func() { cmd.Bake(Opts{Cwd: "/does/not/exist"}).Run() }, ShouldPanic)
+			_, open := <-ch
+			So(open, ShouldBeFalse)
+		})
+	})
+}
+
+func TestPipelines(t *testing.T) {
+	Convey("Given a command with another command as its input", t, func() {
+		cmd := Gosh("sort", Opts{In: Gosh("echo", "3\n1\n2")})
+
+		Convey("The output of the first should flow into the second", func() {
+			So(cmd.Output(), ShouldEqual, "1\n2\n3\n")
+		})
+		Convey("The proc should stand for the whole pipeline", func() {
+			p := cmd.Bake(NullIO.Merge(Opts{In: Gosh("echo", "x")})).Start()
+			So(p, ShouldHaveSameTypeAs, &PipelineProc{})
+			So(p.(*PipelineProc).Stages(), ShouldHaveLength, 2)
+			So(p.GetExitCode(), ShouldEqual, 0)
+			So(p.State(), ShouldEqual, FINISHED)
+		})
+	})
+
+	Convey("Given a pipeline of three commands", t, func() {
+		cmd := Gosh("tr", "a-z", "A-Z", Opts{In: Gosh("sort", Opts{In: Gosh("echo", "b\na")})})
+
+		Convey("Data should flow through every stage", func() {
+			So(cmd.Output(), ShouldEqual, "A\nB\n")
+		})
+		Convey("The pipeline should be flattened", func() {
+			p := cmd.Bake(Opts{Out: ioutil.Discard}).Start().(*PipelineProc)
+			p.Wait()
+			So(p.Stages(), ShouldHaveLength, 3)
+		})
+	})
+
+	Convey("Given a pipeline with a failing first stage", t, func() {
+		cmd := Gosh("cat", NullIO.Merge(Opts{In: Gosh("sh", "-c", "echo hi; exit 3")}))
+
+		Convey("The exit code should be the failing stage's", func() {
+			p := cmd.Start()
+			So(p.GetExitCode(), ShouldEqual, 3)
+			So(p.(*PipelineProc).FailedStage(), ShouldEqual, 0)
+		})
+		Convey("Run should panic naming the failing stage", func() {
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+				errExit := err.(FailureExitCode)
+				So(errExit.Cmdname, ShouldEqual, "sh")
+				So(errExit.Cmdline, ShouldEqual, `sh -c 'echo hi; exit 3' | cat >/dev/null 2>&1`)
+				So(errExit.Code, ShouldEqual, 3)
+				So(errExit.PipelineStage, ShouldEqual, 1)
+			}()
+			cmd.Run()
+		})
+		Convey("The failing stage may be permitted by its own OkExit", func() {
+			p := Gosh("cat", NullIO.Merge(Opts{In: Gosh("sh", "-c", "exit 3", Opts{OkExit: []int{3}})})).Run()
+			So(p.GetExitCode(), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given a pipeline that takes a while", t, func() {
+		p := Gosh("cat", NullIO.Merge(Opts{In: Gosh("sleep", "5")})).Start()
+
+		Convey("Kill should end every stage", func() {
+			p.Kill()
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			for _, stage := range p.(*PipelineProc).Stages() {
+				So(stage.State().IsDone(), ShouldBeTrue)
+			}
+		})
+	})
+
+	Convey("Given a pipeline whose second stage can't launch", t, func() {
+		finishFirst := func(cmdt Opts) Proc {
+			p := ExecLauncher(cmdt)
+			p.Wait()
+			return p
+		}
+		cmd := Pipe(Gosh("true", Opts{Launcher: finishFirst}), Gosh("cat", Opts{Cwd: "/nonexistent"}))
+
+		Convey("The launch error should be raised, even if the first stage is already done", func() {
+			_, err := cmd.StartE()
+			So(err, ShouldHaveSameTypeAs, NoSuchCwdError{})
+		})
+	})
+}
+
+func TestPipe(t *testing.T) {
+	Convey("Given a pipe of several commands", t, func() {
+		cmd := Pipe(
+			Gosh("sh", "-c", "echo b; echo a; exit 2", Opts{OkExit: []int{2}}),
+			Gosh("sort"),
+			Gosh("tr", "a-z", "A-Z"),
+		)
+
+		Convey("Output should come from the last stage", func() {
+			So(cmd.Output(), ShouldEqual, "A\nB\n")
+		})
+		Convey("Each stage's exit code should be reported", func() {
+			p := cmd.Bake(Opts{Out: ioutil.Discard}).Start()
+			So(p.(*PipelineProc).ExitCodes(), ShouldResemble, []int{2, 0, 0})
+			So(p.GetExitCode(), ShouldEqual, 0)
+		})
+		Convey("Usage should span every stage", func() {
+			p := cmd.Bake(Opts{Out: ioutil.Discard}).Start()
+			p.Wait()
+			u := p.Usage()
+			for _, stage := range p.(*PipelineProc).Stages() {
+				So(stage.Usage().Start, ShouldHappenOnOrAfter, u.Start)
+				So(stage.Usage().End, ShouldHappenOnOrBefore, u.End)
+				So(stage.Usage().MaxRSS, ShouldBeLessThanOrEqualTo, u.MaxRSS)
+			}
+		})
+		Convey("A failing middle stage should be named", func() {
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+				errExit := err.(FailureExitCode)
+				So(errExit.Cmdname, ShouldEqual, "sort")
+				So(errExit.PipelineStage, ShouldEqual, 2)
+			}()
+			Pipe(
+				Gosh("echo", "a"),
+				Gosh("sort", "--no-such-flag", NullIO),
+				Gosh("cat", Opts{Out: ioutil.Discard}),
+			).Run()
+		})
+	})
+
+	Convey("A pipe of one command should be that command", t, func() {
+		So(Pipe(Gosh("echo", "hi")).Output(), ShouldEqual, "hi\n")
+	})
+}
+
+func TestContextCancellation(t *testing.T) {
+	Convey("Given a command with a context", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cmd := Gosh("sleep", "5", ctx, NullIO)
+
+		Convey("Cancelling the context should stop the proc", func() {
+			p := cmd.Start()
+			time.AfterFunc(20*time.Millisecond, cancel)
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			So(p.State(), ShouldEqual, CANCELLED)
+			So(p.Err(), ShouldHaveSameTypeAs, CancelledError{})
+			So(p.Err().(CancelledError).Cause, ShouldEqual, context.Canceled)
+		})
+		Convey("Run should panic with a CancelledError", func() {
+			time.AfterFunc(20*time.Millisecond, cancel)
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, CancelledError{})
+				So(err.(CancelledError).Cmdname, ShouldEqual, "sleep")
+			}()
+			cmd.Run()
+		})
+		Convey("A context that's already done should prevent launch", func() {
+			cancel()
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, CancelledError{})
+			}()
+			cmd.Start()
+		})
+		Convey("A context that's never done should have no effect", func() {
+			p := Gosh("true", Opts{Context: ctx}).Run()
+			So(p.State(), ShouldEqual, FINISHED)
+			So(p.Err(), ShouldBeNil)
+		})
+	})
+
+	Convey("Given a pipeline with a context", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		p := Pipe(Gosh("sleep", "5"), Gosh("cat", NullIO, ctx)).Start()
+
+		Convey("Every stage should be stopped", func() {
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			So(p.State(), ShouldEqual, CANCELLED)
+			for _, stage := range p.(*PipelineProc).Stages() {
+				So(stage.State(), ShouldEqual, CANCELLED)
+			}
+			So(p.Err().(CancelledError).Cause, ShouldResemble, context.DeadlineExceeded)
+		})
+	})
+}
+
+func TestTimeouts(t *testing.T) {
+	Convey("Given a command that outlives its timeout", t, func() {
+		cmd := Gosh("sleep", "5", NullIO, Opts{Timeout: 20 * time.Millisecond})
+
+		Convey("Run should panic with a TimeoutError", func() {
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, TimeoutError{})
+				So(err.(TimeoutError).Timeout, ShouldEqual, 20*time.Millisecond)
+			}()
+			cmd.Run()
+		})
+		Convey("The proc should be cancelled by SIGTERM", func() {
+			p := cmd.Start()
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			So(p.State(), ShouldEqual, CANCELLED)
+			So(p.GetExitCode(), ShouldEqual, 128+int(syscall.SIGTERM))
+		})
+		Convey("The stop signal should be configurable", func() {
+			p := cmd.Bake(Opts{StopSignal: syscall.SIGINT}).Start()
+			So(p.GetExitCode(), ShouldEqual, 128+int(syscall.SIGINT))
+		})
+	})
+
+	Convey("Given a command that ignores the stop signal", t, func() {
+		cmd := Gosh("sh", "-c", "trap '' TERM; exec sleep 5", NullIO, Opts{
+			Timeout:   20 * time.Millisecond,
+			StopGrace: 50 * time.Millisecond,
+		})
+
+		Convey("It should be killed after the grace period", func() {
+			p := cmd.Start()
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			So(p.State(), ShouldEqual, CANCELLED)
+			So(p.GetExitCode(), ShouldEqual, 128+int(syscall.SIGKILL))
+			So(p.Err(), ShouldHaveSameTypeAs, TimeoutError{})
+		})
+	})
+
+	Convey("Given a pipeline with a timeout and stop signal", t, func() {
+		// neither stage may exit on its own when the other is stopped, or it would race its own timeout
+		p := Pipe(Gosh("sleep", "5"), Gosh("sleep", "5", NullIO, Opts{
+			Timeout:    20 * time.Millisecond,
+			StopSignal: syscall.SIGINT,
+		})).Start()
+
+		Convey("Every stage should be stopped with that signal", func() {
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			for _, stage := range p.(*PipelineProc).Stages() {
+				So(stage.ExitStatus().Signal, ShouldEqual, syscall.SIGINT)
+			}
+		})
+	})
+
+	Convey("Given a command that finishes within its timeout", t, func() {
+		p := Gosh("true", Opts{Timeout: 1 * time.Second}).Run()
+		So(p.State(), ShouldEqual, FINISHED)
+	})
+}
+
+func TestErrorReturningAPI(t *testing.T) {
+	Convey("Given a command that will succeed", t, func() {
+		cmd := Gosh("echo", "hi", NullIO)
+
+		Convey("RunE should return the proc and no error", func() {
+			p, err := cmd.RunE()
+			So(err, ShouldBeNil)
+			So(p.GetExitCode(), ShouldEqual, 0)
+		})
+		Convey("OutputE should return the output", func() {
+			out, err := cmd.OutputE()
+			So(err, ShouldBeNil)
+			So(out, ShouldEqual, "hi\n")
+		})
+	})
+
+	Convey("Given a command that will exit with 12", t, func() {
+		cmd := Gosh("bash", "-c", "echo failuremessage 1>&2; exit 12", NullIO)
+
+		Convey("RunE should return a FailureExitCode and the proc", func() {
+			p, err := cmd.RunE()
+			So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+			So(err.(FailureExitCode).Code, ShouldEqual, 12)
+			So(p.GetExitCode(), ShouldEqual, 12)
+		})
+		Convey("The error should work with errors.As", func() {
+			_, err := cmd.RunE()
+			var exitErr FailureExitCode
+			So(errors.As(err, &exitErr), ShouldBeTrue)
+			So(exitErr.Code, ShouldEqual, 12)
+			var goshErr Error
+			So(errors.As(err, &goshErr), ShouldBeTrue)
+		})
+		Convey("RunAndReportE should include the output", func() {
+			_, err := cmd.RunAndReportE()
+			So(err.(FailureExitCode).Message, ShouldEqual, "failuremessage\n")
+		})
+		Convey("CombinedOutputE should return both the output and the error", func() {
+			out, err := cmd.CombinedOutputE()
+			So(out, ShouldEqual, "failuremessage\n")
+			So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+		})
+	})
+
+	Convey("Given a command that cannot be launched", t, func() {
+		cmd := Gosh("surely-not-a-command", NullIO)
+
+		Convey("StartE should return a NoSuchCommandError", func() {
+			p, err := cmd.StartE()
+			So(p, ShouldBeNil)
+			So(err, ShouldHaveSameTypeAs, NoSuchCommandError{})
+		})
+		Convey("RunE should return a NoSuchCommandError", func() {
+			_, err := cmd.RunE()
+			So(err, ShouldHaveSameTypeAs, NoSuchCommandError{})
+		})
+	})
+}
+
+func TestProcGroups(t *testing.T) {
+	Convey("Given a shell wrapper with children in its own process group", t, func() {
+		var buf bytes.Buffer
+		// the child holding onto stdout means the proc can't finish until the child is gone too
+		cmd := Gosh("sh", "-c", "sleep 5 & wait", Opts{Out: &buf, Err: &buf, ProcGroup: ProcGroupNew})
+
+		Convey("It should have a group of its own", func() {
+			p := cmd.Start()
+			defer p.KillGroup()
+			pgid, err := syscall.Getpgid(p.Pid())
+			So(err, ShouldBeNil)
+			So(pgid, ShouldEqual, p.Pid())
+			So(pgid, ShouldNotEqual, syscall.Getpgrp())
+		})
+		Convey("KillGroup should reach the children", func() {
+			p := cmd.Start()
+			time.Sleep(50 * time.Millisecond)
+			p.KillGroup()
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			So(p.GetExitCode(), ShouldEqual, 128+int(syscall.SIGKILL))
+		})
+		Convey("SignalGroup should refuse once the group is gone", func() {
+			// no children this time: those could linger as zombies until init gets round to them
+			p := Gosh("sleep", "5", NullIO, Opts{ProcGroup: ProcGroupNew}).Start()
+			p.KillGroup()
+			p.Wait()
+			defer func() {
+				So(recover(), ShouldResemble, ProcMonitorError{os.ErrProcessDone})
+			}()
+			p.SignalGroup(syscall.SIGTERM)
+		})
+		Convey("Timeouts with StopGroup should reach the children", func() {
+			p := cmd.Bake(Opts{Timeout: 50 * time.Millisecond, StopGroup: true}).Start()
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			So(p.State(), ShouldEqual, CANCELLED)
+		})
+		Convey("The grace period's kill should reach children that outlive the process", func() {
+			stubborn := Gosh("sh", "-c", `(trap "" TERM; exec sleep 5) & wait`, Opts{Out: &buf, Err: &buf, ProcGroup: ProcGroupNew})
+			p := stubborn.Bake(Opts{Timeout: 100 * time.Millisecond, StopGrace: 300 * time.Millisecond, StopGroup: true}).Start()
+			So(p.WaitSoon(2*time.Second), ShouldBeTrue)
+			So(p.State(), ShouldEqual, CANCELLED)
+		})
+	})
+
+	Convey("Given a command in gosh's own process group", t, func() {
+		p := Gosh("sleep", "5", NullIO).Start()
+
+		Convey("KillGroup should only kill the process", func() {
+			p.KillGroup()
+			So(p.WaitSoon(1*time.Second), ShouldBeTrue)
+			So(p.GetExitCode(), ShouldEqual, 128+int(syscall.SIGKILL))
+		})
+	})
+}
+
+func TestExitStatuses(t *testing.T) {
+	Convey("Given a command killed by a signal", t, func() {
+		cmd := Gosh("sh", "-c", "kill -TERM $$", NullIO)
+
+		Convey("Run should panic with the signal in the status", func() {
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+				errExit := err.(FailureExitCode)
+				So(errExit.Code, ShouldEqual, 128+int(syscall.SIGTERM))
+				So(errExit.Status, ShouldResemble, ExitStatus{Signal: syscall.SIGTERM})
+			}()
+			cmd.Run()
+		})
+		Convey("The 128+signal code should still be accepted as success", func() {
+			_, err := cmd.Bake(Opts{OkExit: []int{0, 128 + int(syscall.SIGTERM)}}).RunE()
+			So(err, ShouldBeNil)
+		})
+		Convey("The signal should be accepted with SignalExit", func() {
+			_, err := cmd.Bake(Opts{OkExit: []int{0, SignalExit(syscall.SIGTERM)}}).RunE()
+			So(err, ShouldBeNil)
+		})
+		Convey("AnyExit should accept it", func() {
+			_, err := cmd.Bake(Opts{OkExit: AnyExit}).RunE()
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Given a pipeline where the first stage is cut off by the second", t, func() {
+		yes := Gosh("yes")
+
+		Convey("The first stage should fail by SIGPIPE", func() {
+			_, err := Pipe(yes, Gosh("head", "-n1", NullIO)).RunE()
+			So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+			So(err.(FailureExitCode).Status.Signal, ShouldEqual, syscall.SIGPIPE)
+			So(err.(FailureExitCode).PipelineStage, ShouldEqual, 1)
+		})
+		Convey("SIGPIPE can be accepted as success", func() {
+			out := Pipe(yes.Bake(Opts{OkExit: []int{0, SignalExit(syscall.SIGPIPE)}}), Gosh("head", "-n1")).Output()
+			So(out, ShouldEqual, "y\n")
+		})
+	})
+}
+
+func TestOutputDecoders(t *testing.T) {
+	Convey("Given a command emitting JSON", t, func() {
+		cmd := Gosh("echo", `{"name": "gosh", "tags": ["a", "b"]}`)
+
+		Convey("OutputJSON should unmarshal it", func() {
+			var v struct {
+				Name string
+				Tags []string
+			}
+			cmd.OutputJSON(&v)
+			So(v.Name, ShouldEqual, "gosh")
+			So(v.Tags, ShouldResemble, []string{"a", "b"})
+		})
+		Convey("OutputJSON into the wrong type should raise a decode error", func() {
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, OutputDecodeError{})
+				So(err.(OutputDecodeError).Cmdname, ShouldEqual, "echo")
+				So(err.(OutputDecodeError).Format, ShouldEqual, "JSON")
+				So(err.(OutputDecodeError).Cause, ShouldHaveSameTypeAs, &json.UnmarshalTypeError{})
+				So(err.(OutputDecodeError).Snippet, ShouldEqual, `{"name": "gosh", "tags": ["a", "b"]}`+"\n")
+			}()
+			var v []int
+			cmd.OutputJSON(&v)
+		})
+	})
+
+	Convey("Given a command emitting something that's not JSON", t, func() {
+		cmd := Gosh("echo", `{"name": gosh}`)
+
+		Convey("OutputJSON should raise a decode error", func() {
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, OutputDecodeError{})
+				So(err.(OutputDecodeError).Cmdname, ShouldEqual, "echo")
+				So(err.(OutputDecodeError).Snippet, ShouldContainSubstring, "gosh}")
+			}()
+			var v interface{}
+			cmd.OutputJSON(&v)
+		})
+	})
+
+	Convey("Given a command emitting a stream of JSON", t, func() {
+		cmd := Gosh("printf", `{"n":1}\n{"n":2}\n[3]\n`)
+
+		Convey("OutputJSONStream should hand over each value", func() {
+			var got []string
+			cmd.OutputJSONStream(func(msg json.RawMessage) {
+				got = append(got, string(msg))
+			})
+			So(got, ShouldResemble, []string{`{"n":1}`, `{"n":2}`, `[3]`})
+		})
+		Convey("OutputJSONStream should raise a decode error on garbage", func() {
+			var got []string
+			defer func() {
+				err := recover()
+				So(err, ShouldHaveSameTypeAs, OutputDecodeError{})
+				So(err.(OutputDecodeError).Snippet, ShouldContainSubstring, "nope")
+				So(got, ShouldResemble, []string{`{"n":1}`})
+			}()
+			Gosh("printf", `{"n":1}\nnope\n`).OutputJSONStream(func(msg json.RawMessage) {
+				got = append(got, string(msg))
+			})
+		})
+		Convey("OutputJSONStream should still check the exit code", func() {
+			So(func() {
+				Gosh("sh", "-c", `echo '{}'; exit 2`).OutputJSONStream(func(json.RawMessage) {})
+			}, ShouldPanic)
+		})
+	})
+
+	Convey("Given a command emitting a table", t, func() {
+		cmd := Gosh("printf", "a  1\n\nb\t2 x\n")
+
+		Convey("OutputLines should split it into lines", func() {
+			So(cmd.OutputLines(), ShouldResemble, []string{"a  1", "", "b\t2 x"})
+		})
+		Convey("OutputFields should split it into fields", func() {
+			So(cmd.OutputFields(), ShouldResemble, [][]string{{"a", "1"}, {"b", "2", "x"}})
+		})
+		Convey("No output should be no lines", func() {
+			So(Gosh("true").OutputLines(), ShouldHaveLength, 0)
+		})
+	})
+}
+
+func TestCaptureLimits(t *testing.T) {
+	Convey("Given a command with lots of output", t, func() {
+		cmd := Gosh("sh", "-c", `seq 1 100000; exit 2`)
+
+		Convey("RunAndReport should keep only the ends of the output", func() {
+			_, err := cmd.RunAndReportE()
+			So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+			msg := err.(FailureExitCode).Message
+			So(msg, ShouldStartWith, "1\n2\n3\n")
+			So(msg, ShouldEndWith, "99999\n100000\n")
+			So(msg, ShouldContainSubstring, "bytes elided")
+		})
+		Convey("RunAndReport should respect the configured limit", func() {
+			_, err := cmd.Bake(Opts{Capture: CaptureLimit{Head: 2, Tail: 7}}).RunAndReportE()
+			So(err.(FailureExitCode).Message, ShouldEqual, "1\n\n...588886 bytes elided...\n100000\n")
+		})
+		Convey("Output should keep everything by default", func() {
+			out, _ := cmd.OutputE()
+			So(out, ShouldHaveLength, 588895)
+		})
+		Convey("Output should respect the configured limit", func() {
+			out, _ := cmd.Bake(Opts{Capture: CaptureLimit{Tail: 7}}).OutputE()
+			So(out, ShouldEqual, "\n...588888 bytes elided...\n100000\n")
+		})
+		Convey("CaptureNothing should keep nothing", func() {
+			out, _ := cmd.Bake(Opts{Capture: CaptureNothing}).OutputE()
+			So(out, ShouldEqual, "\n...588895 bytes elided...\n")
+		})
+		Convey("Nonsense limits should be rejected", func() {
+			_, err := cmd.Bake(Opts{Capture: CaptureLimit{Head: -5, Tail: 10}}).OutputE()
+			So(err, ShouldResemble, CaptureLimitError{Limit: CaptureLimit{Head: -5, Tail: 10}})
+		})
+	})
+}
+
+func TestReportStreams(t *testing.T) {
+	Convey("Given a failing command writing to both streams", t, func() {
+		cmd := Gosh("sh", "-c", `echo one; sleep 0.01; echo two >&2; sleep 0.01; echo three; exit 1`)
+
+		Convey("RunAndReport should report the streams separately and together", func() {
+			_, err := cmd.RunAndReportE()
+			So(err, ShouldHaveSameTypeAs, FailureExitCode{})
+			fail := err.(FailureExitCode)
+			So(fail.Stdout, ShouldEqual, "one\nthree\n")
+			So(fail.Stderr, ShouldEqual, "two\n")
+			So(fail.Message, ShouldEqual, "one\ntwo\nthree\n")
+			So(fail.Transcript().String(), ShouldEqual, "out| one\nerr| two\nout| three\n")
+			So(fail.Transcript()[0].Time.After(fail.Transcript()[1].Time), ShouldBeFalse)
+			So(err == error(fail), ShouldBeTrue) // still comparable
+		})
+		Convey("The transcript should mark where output was dropped", func() {
+			_, err := cmd.Bake(Opts{Capture: CaptureLimit{Head: 4, Tail: 6}}).RunAndReportE()
+			fail := err.(FailureExitCode)
+			So(fail.Stdout, ShouldEqual, "one\nthree\n")
+			So(fail.Message, ShouldEqual, "one\n\n...4 bytes elided...\nthree\n")
+			So(fail.Transcript().String(), ShouldEqual, "out| one\n...4 bytes elided...\nout| three\n")
+		})
+	})
+}
+
+func TestTee(t *testing.T) {
+	Convey("Given a command with its output going several places", t, func() {
+		var buf1, buf2 bytes.Buffer
+		ch := make(chan string, 10)
+		sinks := []interface{}{&buf1, &buf2, ch}
+		cmd := Gosh("sh", "-c", "echo out; echo err >&2", Opts{Out: sinks, Err: sinks})
+
+		Convey("Every sink should get all of it", func() {
+			cmd.Run()
+			So(buf1.String(), ShouldEqual, "out\nerr\n")
+			So(buf2.String(), ShouldEqual, "out\nerr\n")
+			So(len(ch), ShouldEqual, 2)
+		})
+	})
+
+	Convey("Given a failing command with live output", t, func() {
+		var live bytes.Buffer
+		cmd := Gosh("sh", "-c", "echo out; sleep 0.01; echo err >&2; exit 1", Opts{Out: &live, Err: &live})
+
+		Convey("RunAndReport should only report the output", func() {
+			_, err := cmd.RunAndReportE()
+			So(err.(FailureExitCode).Message, ShouldEqual, "out\nerr\n")
+			So(live.String(), ShouldEqual, "")
+		})
+		Convey("RunAndReportLive should both show and report the output", func() {
+			_, err := cmd.RunAndReportLiveE()
+			So(err.(FailureExitCode).Message, ShouldEqual, "out\nerr\n")
+			So(live.String(), ShouldEqual, "out\nerr\n")
+		})
+	})
+
+	Convey("Given a command with live output to a channel it should close", t, func() {
+		ch := make(chan string, 10)
+
+		Convey("RunAndReportLive should close the channel when done", func() {
+			Gosh("sh", "-c", "echo one; echo two", Opts{Out: ch, CloseOut: true}).RunAndReportLive()
+			var lines []string
+			for line := range ch {
+				lines = append(lines, line)
+			}
+			So(lines, ShouldResemble, []string{"one\n", "two\n"})
+		})
+		Convey("Even when Err shares the channel", func() {
+			Gosh("sh", "-c", "echo one; echo two >&2", Opts{Out: ch, Err: ch, CloseOut: true}).RunAndReportLive()
+			var lines []string
+			for line := range ch {
+				lines = append(lines, line)
+			}
+			So(lines, ShouldHaveLength, 2)
+		})
+	})
+}
+
+func TestDecoration(t *testing.T) {
+	Convey("Given commands sharing an output with labels", t, func() {
+		var buf bytes.Buffer
+		opts := Opts{Out: &buf, Err: &buf, Decorate: Decoration{Label: true}}
+
+		Convey("Each line should be labelled with its command", func() {
+			Gosh("sh", "-c", "echo one; printf two", opts).Run()
+			Gosh("echo", "three", opts).Run()
+			So(buf.String(), ShouldEqual, "sh| one\nsh| two\necho| three\n")
+		})
+		Convey("The label should be configurable", func() {
+			Gosh("echo", "one", opts, Opts{Decorate: Decoration{Label: true, LabelText: "job1"}}).Run()
+			So(buf.String(), ShouldEqual, "job1| one\n")
+		})
+		Convey("Lines should stay whole when commands run at once", func() {
+			var procs []Proc
+			for _, word := range []string{"aaaa", "bbbb", "cccc"} {
+				procs = append(procs, Gosh("sh", "-c", "for i in 1 2 3 4 5 6 7 8 9 10; do printf "+word[:2]+"; printf '"+word[2:]+"\\n'; done", opts).Start())
+			}
+			for _, p := range procs {
+				p.Wait()
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+				So(line, ShouldBeIn, []string{"sh| aaaa", "sh| bbbb", "sh| cccc"})
+			}
+		})
+	})
+
+	Convey("Given a command with timestamped output going to a channel", t, func() {
+		ch := make(chan string, 10)
+		cmd := Gosh("echo", "one", Opts{Out: ch, Decorate: Decoration{Timestamp: "2006"}})
+
+		Convey("The line should be stamped", func() {
+			cmd.Run()
+			So(<-ch, ShouldEqual, time.Now().Format("2006")+" one\n")
+		})
+	})
+}
+
+func TestRedirects(t *testing.T) {
+	Convey("Given a scratch directory", t, func() {
+		dir, err := ioutil.TempDir("", "gosh-test-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "out.log")
+
+		Convey("File should create and then truncate", func() {
+			Gosh("echo", "one", Opts{Out: File(path)}).Run()
+			Gosh("echo", "two", Opts{Out: File(path)}).Run()
+			content, _ := ioutil.ReadFile(path)
+			So(string(content), ShouldEqual, "two\n")
+			fi, _ := os.Stat(path)
+			So(fi.Mode().Perm()&^RedirectPerm, ShouldEqual, 0)
+		})
+		Convey("Append should append", func() {
+			Gosh("echo", "one", Opts{Out: Append(path)}).Run()
+			Gosh("echo", "two", Opts{Out: Append(path)}).Run()
+			content, _ := ioutil.ReadFile(path)
+			So(string(content), ShouldEqual, "one\ntwo\n")
+		})
+		Convey("Out and Err should be able to share a file", func() {
+			Gosh("sh", "-c", "echo out; echo err >&2", Opts{Out: File(path), Err: File(path)}).Run()
+			content, _ := ioutil.ReadFile(path)
+			So(string(content), ShouldEqual, "out\nerr\n")
+		})
+		Convey("Decorated output should all reach the file", func() {
+			Gosh("sh", "-c", "sleep 0.1; echo out; printf err >&2", Opts{Out: File(path), Err: File(path), Decorate: Decoration{Label: true}}).Run()
+			content, _ := ioutil.ReadFile(path)
+			So(string(content), ShouldEqual, "sh| out\nsh| err\n")
+		})
+		Convey("FromFile should feed the file in", func() {
+			ioutil.WriteFile(path, []byte("b\na\n"), 0644)
+			So(Gosh("sort", Opts{In: FromFile(path)}).Output(), ShouldEqual, "a\nb\n")
+		})
+		Convey("RunAndReportLive should still write to the file", func() {
+			_, err := Gosh("sh", "-c", "echo out; exit 1", Opts{Out: File(path)}).RunAndReportLiveE()
+			So(err.(FailureExitCode).Message, ShouldEqual, "out\n")
+			content, _ := ioutil.ReadFile(path)
+			So(string(content), ShouldEqual, "out\n")
+		})
+		Convey("Files that can't be opened should be reported", func() {
+			_, err := Gosh("cat", Opts{In: FromFile(filepath.Join(dir, "nope"))}).RunE()
+			So(err, ShouldHaveSameTypeAs, RedirectError{})
+			So(err.(RedirectError).Cause, ShouldHaveSameTypeAs, &os.PathError{})
+		})
+		Convey("Redirects the wrong way round should be rejected", func() {
+			_, err := Gosh("cat", Opts{In: File(path)}).RunE()
+			So(err, ShouldHaveSameTypeAs, RedirectError{})
+			_, err = os.Stat(path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+func TestExtraFDs(t *testing.T) {
+	Convey("Given a command using extra fds", t, func() {
+		var status bytes.Buffer
+		cmd := Gosh("sh", "-c", `read secret <&3; echo "got $secret" >&4; echo done`, Opts{ExtraFD: map[int]interface{}{
+			3: "hunter2\n",
+			4: &status,
+		}})
+
+		Convey("Data should flow both ways", func() {
+			So(cmd.Output(), ShouldEqual, "done\n")
+			So(status.String(), ShouldEqual, "got hunter2\n")
+		})
+		Convey("Baking should merge fds", func() {
+			ch := make(chan string, 1)
+			cmd.Bake(Opts{ExtraFD: map[int]interface{}{4: ExtraOut(ch)}}).Run()
+			So(<-ch, ShouldEqual, "got hunter2\n")
+			So(status.Len(), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given extra fds that won't do", t, func() {
+		Convey("Fds below 3 should be rejected", func() {
+			_, err := Gosh("true", Opts{ExtraFD: map[int]interface{}{2: "x"}}).RunE()
+			So(err, ShouldHaveSameTypeAs, ExtraFDError{})
+		})
+		Convey("Values with no direction should be rejected", func() {
+			_, err := Gosh("true", Opts{ExtraFD: map[int]interface{}{3: make(chan string)}}).RunE()
+			So(err, ShouldHaveSameTypeAs, ExtraFDError{})
+		})
+		Convey("Files opened for output shouldn't be left open if setup fails after them", func() {
+			dir, err := ioutil.TempDir("", "gosh-test-")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			var f *os.File
+			_, err = Gosh("true", Opts{
+				Out: File(filepath.Join(dir, "out")),
+				Launcher: ExecCustomizingLauncher(func(cmd *exec.Cmd) {
+					f = cmd.Stdout.(*os.File)
+					panic(ExtraFDError{FD: 3, Cause: errors.New("nope")})
+				}),
+			}).RunE()
+			So(err, ShouldHaveSameTypeAs, ExtraFDError{})
+			So(errors.Is(f.Close(), os.ErrClosed), ShouldBeTrue)
+		})
+		Convey("A command that can't start shouldn't leave anything hanging", func() {
+			var buf bytes.Buffer
+			_, err := Gosh("/does/not/exist", Opts{ExtraFD: map[int]interface{}{3: "x", 4: &buf}}).RunE()
+			So(err, ShouldHaveSameTypeAs, NoSuchCommandError{})
+		})
+	})
+}
+
+func TestCommandString(t *testing.T) {
+	Convey("Commands should render as a line of shell", t, func() {
+		cmd := Gosh("echo", "a b", Env{"GOSH_TEST": "x y"}, Opts{Cwd: "/tmp", Out: File("out")})
+		So(cmd.String(), ShouldEqual, `cd /tmp && GOSH_TEST='x y' echo 'a b' >out`)
+		So(fmt.Sprint(cmd), ShouldEqual, cmd.String())
+
+		Convey("A command name with an = shouldn't read as an env assignment", func() {
+			So(Gosh("FOO=bar", "x=y").String(), ShouldEqual, `'FOO=bar' x=y`)
+		})
+		Convey("Failures should carry the rendering", func() {
+			_, err := Gosh("sh", "-c", "exit 2", Opts{Cwd: "/tmp"}).RunE()
+			So(err.(FailureExitCode).Cmdline, ShouldEqual, `cd /tmp && sh -c 'exit 2'`)
+			So(err.Error(), ShouldContainSubstring, "Command was:\n\t\tcd /tmp && sh -c 'exit 2'")
+		})
+		Convey("Failure messages shouldn't give away env values", func() {
+			_, err := Gosh("sh", "-c", "exit 2", Env{"GOSH_TOKEN": "hunter2"}).RunE()
+			So(err.(FailureExitCode).Cmdline, ShouldContainSubstring, "GOSH_TOKEN=hunter2")
+			So(err.Error(), ShouldContainSubstring, "Command was:\n\t\tGOSH_TOKEN=... sh -c 'exit 2'")
+			So(err.Error(), ShouldNotContainSubstring, "hunter2")
+		})
+	})
 }
@@ -0,0 +1,136 @@
+package gosh
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ Proc = &syntheticProc{}
+
+/*
+	`gosh.Proc` implementation for things that only look like processes,
+	like the commands served up by `ReplayLauncher`.
+
+	It's RUNNING until `finish` is called, and then FINISHED with whatever
+	exit status it was made with.  There's no actual process, so there's
+	nothing to signal; `Kill` and friends do nothing.
+*/
+type syntheticProc struct {
+	/* Guards transitions, same as in `ExecProc`. */
+	mutex sync.Mutex
+
+	/* Always access this with functions from the atomic package. */
+	state int32
+
+	exitStatus ExitStatus
+
+	usage ResourceUsage
+
+	exitCh chan struct{}
+
+	exitListeners []func(Proc)
+}
+
+func newSyntheticProc(status ExitStatus) *syntheticProc {
+	return &syntheticProc{
+		state:      int32(RUNNING),
+		exitStatus: status,
+		usage:      ResourceUsage{Start: time.Now()},
+		exitCh:     make(chan struct{}),
+	}
+}
+
+func (p *syntheticProc) State() State {
+	return State(atomic.LoadInt32(&p.state))
+}
+
+func (p *syntheticProc) Pid() int {
+	return 0
+}
+
+func (p *syntheticProc) WaitChan() <-chan struct{} {
+	return p.exitCh
+}
+
+func (p *syntheticProc) Wait() {
+	<-p.WaitChan()
+}
+
+func (p *syntheticProc) WaitSoon(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return false
+	case <-p.WaitChan():
+		return true
+	}
+}
+
+func (p *syntheticProc) GetExitCode() int {
+	p.Wait()
+	return p.exitStatus.ShellCode()
+}
+
+func (p *syntheticProc) GetExitCodeSoon(d time.Duration) int {
+	if p.WaitSoon(d) {
+		return p.exitStatus.ShellCode()
+	} else {
+		return -1
+	}
+}
+
+func (p *syntheticProc) ExitStatus() ExitStatus {
+	p.Wait()
+	return p.exitStatus
+}
+
+func (p *syntheticProc) Err() error {
+	return nil
+}
+
+func (p *syntheticProc) Usage() ResourceUsage {
+	if !p.State().IsDone() {
+		return ResourceUsage{}
+	}
+	return p.usage
+}
+
+func (p *syntheticProc) AddExitListener(callback func(Proc)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.State().IsDone() {
+		// TODO: a better standard of panic handling here
+		callback(p)
+	} else {
+		p.exitListeners = append(p.exitListeners, callback)
+	}
+}
+
+func (p *syntheticProc) Kill() {}
+
+func (p *syntheticProc) Signal(os.Signal) {}
+
+func (p *syntheticProc) SignalGroup(os.Signal) {}
+
+func (p *syntheticProc) KillGroup() {}
+
+//
+// Below lieth Guts
+//
+
+func (p *syntheticProc) finish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.usage.End = time.Now()
+	atomic.StoreInt32(&p.state, int32(FINISHED))
+	for _, cb := range p.exitListeners {
+		func() {
+			// TODO: a better standard of panic handling here
+			cb(p)
+		}()
+	}
+	close(p.exitCh)
+}
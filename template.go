@@ -0,0 +1,113 @@
+package gosh
+
+/*
+	Returns the template the command was baked from: its args, env, cwd,
+	and all the other `Opts`.
+
+	This is a deep copy, like with `Bake()` -- changing it has no effect
+	on the command -- except for the In/Out/Err readers and writers, and
+	other references like `Context`, which are the very same ones the
+	command holds.  To launch something from an edited copy, use
+	`Opts.Command()`.
+*/
+func (c Command) Opts() Opts {
+	return c.expose().clone()
+}
+
+/*
+	Returns a Command launching exactly what's in the template.
+
+	Unlike `Gosh(opts)`, there are no defaults merged in: zero values stay
+	zero (so e.g. a nil `Out` means output is discarded, and a nil
+	`Launcher` means the command can't be launched at all).  This makes it
+	the way back from `Command.Opts()`.
+*/
+func (cmdt Opts) Command() Command {
+	return enclose(cmdt.clone())
+}
+
+/*
+	Returns a new Command with the args replaced by whatever `fn` returns,
+	given a copy of the current args (the command name first).
+
+	This is for the edits that `Bake()` can't make, since it only ever
+	appends args: removing and replacing baked-in flags, inserting args in
+	the middle, and so on.  See also `WithoutArgs()` and `ReplaceArg()`.
+*/
+func (c Command) EditArgs(fn func(args []string) []string) Command {
+	cmdt := c.Opts()
+	cmdt.Args = fn(cmdt.Args)
+	return enclose(cmdt)
+}
+
+/*
+	Returns a new Command with every arg equal to one of `args` removed
+	(except the command name, which is never removed).
+*/
+func (c Command) WithoutArgs(args ...string) Command {
+	return c.EditArgs(func(old []string) []string {
+		if len(old) == 0 {
+			return old
+		}
+		edited := old[:1]
+		for _, arg := range old[1:] {
+			if !containsString(args, arg) {
+				edited = append(edited, arg)
+			}
+		}
+		return edited
+	})
+}
+
+/*
+	Returns a new Command with every arg equal to `old` replaced by `new`
+	(except the command name, which is never replaced).
+*/
+func (c Command) ReplaceArg(old, new string) Command {
+	return c.EditArgs(func(args []string) []string {
+		for i := 1; i < len(args); i++ {
+			if args[i] == old {
+				args[i] = new
+			}
+		}
+		return args
+	})
+}
+
+/*
+	Copies everything in the template that `Merge` or an edit could
+	otherwise end up mutating through a shared reference.  A nil `Env`
+	stays nil (which means something different from an empty one).
+*/
+func (cmdt Opts) clone() Opts {
+	if cmdt.Args != nil {
+		cmdt.Args = append([]string{}, cmdt.Args...)
+	}
+	if cmdt.Env != nil {
+		env := make(Env, len(cmdt.Env))
+		for k, v := range cmdt.Env {
+			env[k] = v
+		}
+		cmdt.Env = env
+	}
+	if cmdt.ExtraFD != nil {
+		fds := make(map[int]interface{}, len(cmdt.ExtraFD))
+		for fd, v := range cmdt.ExtraFD {
+			fds[fd] = v
+		}
+		cmdt.ExtraFD = fds
+	}
+	if cmdt.OkExit != nil {
+		cmdt.OkExit = append([]int{}, cmdt.OkExit...)
+	}
+	return cmdt
+}
+
+func containsString(ss []string, s string) bool {
+	for _, s2 := range ss {
+		if s2 == s {
+			return true
+		}
+	}
+	return false
+}
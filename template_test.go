@@ -0,0 +1,49 @@
+package gosh
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCommandTemplates(t *testing.T) {
+	Convey("Given a baked command", t, func() {
+		cmd := Gosh("git", "push", "--force", "origin", Env{"GOSH_TEST": "a"}, Opts{Cwd: "/tmp"})
+
+		Convey("Opts should expose the template", func() {
+			cmdt := cmd.Opts()
+			So(cmdt.Args, ShouldResemble, []string{"git", "push", "--force", "origin"})
+			So(cmdt.Env["GOSH_TEST"], ShouldEqual, "a")
+			So(cmdt.Cwd, ShouldEqual, "/tmp")
+			So(cmdt.OkExit, ShouldResemble, []int{0})
+		})
+
+		Convey("Changing the exposed template shouldn't change the command", func() {
+			cmdt := cmd.Opts()
+			cmdt.Args[1] = "pull"
+			cmdt.Env["GOSH_TEST"] = "b"
+			cmdt.OkExit[0] = 1
+			So(cmd.Opts().Args[1], ShouldEqual, "push")
+			So(cmd.Opts().Env["GOSH_TEST"], ShouldEqual, "a")
+			So(cmd.Opts().OkExit, ShouldResemble, []int{0})
+
+			Convey("But it should launch as edited", func() {
+				So(cmdt.Command().Opts().Args, ShouldResemble, []string{"git", "pull", "--force", "origin"})
+			})
+		})
+
+		Convey("Args should be editable", FailureContinues, func() {
+			So(cmd.WithoutArgs("--force", "git").Opts().Args, ShouldResemble, []string{"git", "push", "origin"})
+			So(cmd.ReplaceArg("--force", "--force-with-lease").Opts().Args, ShouldResemble, []string{"git", "push", "--force-with-lease", "origin"})
+			So(cmd.EditArgs(func(args []string) []string {
+				return append(args[:2], append([]string{"-v"}, args[2:]...)...)
+			}).Opts().Args, ShouldResemble, []string{"git", "push", "-v", "--force", "origin"})
+			So(cmd.Opts().Args, ShouldResemble, []string{"git", "push", "--force", "origin"})
+		})
+
+		Convey("Edited commands should run", func() {
+			out := Gosh("echo", "a", "b", "c").WithoutArgs("b").Output()
+			So(out, ShouldEqual, "a c\n")
+		})
+	})
+}
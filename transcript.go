@@ -0,0 +1,95 @@
+package gosh
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+	Stream identifies one of the standard streams of a process.
+*/
+type Stream int
+
+const (
+	StreamIn Stream = iota
+	StreamOut
+	StreamErr
+)
+
+func (s Stream) String() string {
+	switch s {
+	case StreamIn:
+		return "in"
+	case StreamOut:
+		return "out"
+	case StreamErr:
+		return "err"
+	default:
+		return "?"
+	}
+}
+
+/*
+	TranscriptEntry is a chunk of data that went to or from a process,
+	tagged with which stream it was on and when it was seen.
+*/
+type TranscriptEntry struct {
+	Time   time.Time
+	Stream Stream
+	Data   string
+
+	Elided int64 // if nonzero, this many bytes were dropped from the transcript just before this entry
+}
+
+/*
+	Transcript is a record of the data that went to and from a process,
+	in the order it happened.
+*/
+type Transcript []TranscriptEntry
+
+/*
+	Renders the transcript one line per line of data, each tagged with the
+	stream it was on, e.g.:
+
+		out| What is your name?
+		 in| bob
+		out| hello bob
+*/
+func (t Transcript) String() string {
+	var buf bytes.Buffer
+	for _, entry := range t {
+		if entry.Elided > 0 {
+			fmt.Fprintf(&buf, "...%d bytes elided...\n", entry.Elided)
+		}
+		tag := entry.Stream.String()
+		for _, line := range strings.SplitAfter(entry.Data, "\n") {
+			if line == "" {
+				continue
+			}
+			buf.WriteString(strings.Repeat(" ", 3-len(tag)))
+			buf.WriteString(tag)
+			buf.WriteString("| ")
+			buf.WriteString(strings.TrimSuffix(line, "\n"))
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String()
+}
+
+/*
+	Returns all the data in the transcript run together, without tags, like
+	it would have looked if all the streams had been going to one place.
+	Any gaps are marked like "\n...1234 bytes elided...\n".
+*/
+func (t Transcript) Text() string {
+	var buf bytes.Buffer
+	for _, entry := range t {
+		if entry.Elided > 0 {
+			fmt.Fprintf(&buf, "\n...%d bytes elided...\n", entry.Elided)
+		}
+		buf.WriteString(entry.Data)
+	}
+	return buf.String()
+}